@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"reflect"
+	"time"
+)
+
+// A Batcher is a runner that groups the records it receives into []interface{} batches
+type Batcher struct {
+	size    int
+	maxWait time.Duration
+}
+
+// An Unbatcher is a runner that emits each record of the slices it receives
+type Unbatcher struct{}
+
+// NewBatcher builds a Batcher that emits batches of up to size records. A partial batch is emitted
+// once maxWait has passed since its first record, unless maxWait is 0
+func NewBatcher(size int, maxWait time.Duration) *Batcher {
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher{size: size, maxWait: maxWait}
+}
+
+// NewUnbatcher builds an Unbatcher
+func NewUnbatcher() *Unbatcher {
+	return &Unbatcher{}
+}
+
+// Name implements Runner for Batcher
+func (b *Batcher) Name() string {
+	return "Batch"
+}
+
+// Run implements Runner for Batcher
+//
+// The partial batch is emitted once the input is closed. If the stage is aborted it is emitted only
+// if the next stage is ready for it
+func (b *Batcher) Run(stage *Stage) error {
+	batch := make([]interface{}, 0, b.size)
+
+	// wait is only running while there is a partial batch
+	var timer *time.Timer
+	var wait <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, wait = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	// emit sends the batch, returning false if the stage was aborted
+	emit := func() bool {
+		stopTimer()
+		if len(batch) == 0 {
+			return true
+		}
+		select {
+		case <-stage.Abort:
+			return false
+		case stage.Out <- batch:
+			batch = make([]interface{}, 0, b.size)
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-stage.Abort:
+			if len(batch) != 0 {
+				select {
+				case stage.Out <- batch:
+				default:
+				}
+			}
+			return nil
+		case <-wait:
+			if !emit() {
+				return nil
+			}
+		case rec, ok := <-stage.In:
+			if !ok {
+				emit()
+				return nil
+			}
+
+			batch = append(batch, rec)
+			if len(batch) >= b.size {
+				if !emit() {
+					return nil
+				}
+			} else if timer == nil && b.maxWait > 0 {
+				timer = time.NewTimer(b.maxWait)
+				wait = timer.C
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (b *Batcher) SkipAbortErr() bool {
+	return true
+}
+
+// Name implements Runner for Unbatcher
+func (u *Unbatcher) Name() string {
+	return "Unbatch"
+}
+
+// Run implements Runner for Unbatcher
+//
+// Slices of any type are flattened. Other records are emitted as they are
+func (u *Unbatcher) Run(stage *Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+			if !u.emit(rec, stage) {
+				return nil
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (u *Unbatcher) SkipAbortErr() bool {
+	return true
+}
+
+// emit sends each record of a batch, returning false if the stage was aborted
+func (u *Unbatcher) emit(rec interface{}, stage *Stage) bool {
+	send := func(rec interface{}) bool {
+		select {
+		case <-stage.Abort:
+			return false
+		case stage.Out <- rec:
+			return true
+		}
+	}
+
+	if batch, isBatch := rec.([]interface{}); isBatch {
+		for _, item := range batch {
+			if !send(item) {
+				return false
+			}
+		}
+		return true
+	}
+
+	val := reflect.ValueOf(rec)
+	if val.Kind() != reflect.Slice || val.Type().Elem().Kind() == reflect.Uint8 {
+		// []byte is a record of its own rather than a batch of bytes
+		return send(rec)
+	}
+	for i := 0; i < val.Len(); i++ {
+		if !send(val.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
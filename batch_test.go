@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	// collect runs the pipeline, returning the records it emitted
+	collect := func(p *Pipeline) []interface{} {
+		out := make(chan interface{})
+		errChan := p.StreamTo(out).Build().RunAsync()
+		results := []interface{}{}
+		for rec := range out {
+			results = append(results, rec)
+		}
+		So(<-errChan, ShouldBeNil)
+		return results
+	}
+
+	// from emits the records then closes
+	from := func(records ...interface{}) chan interface{} {
+		in := make(chan interface{}, len(records))
+		for _, rec := range records {
+			in <- rec
+		}
+		close(in)
+		return in
+	}
+
+	Convey("Batch", t, func() {
+		Convey("groups records into batches, emitting the partial batch on close", func() {
+			So(collect(StreamFrom(from(1, 2, 3, 4, 5)).Batch(2, 0)), ShouldResemble, []interface{}{
+				[]interface{}{1, 2}, []interface{}{3, 4}, []interface{}{5},
+			})
+		})
+
+		Convey("emits nothing when there are no records", func() {
+			So(collect(StreamFrom(from()).Batch(2, 0)), ShouldBeEmpty)
+		})
+
+		Convey("emits a partial batch after maxWait", func() {
+			in := make(chan interface{})
+			out := make(chan interface{})
+			errChan := StreamFrom(in).Batch(10, 10*time.Millisecond).StreamTo(out).Build().RunAsync()
+
+			in <- 1
+			in <- 2
+			select {
+			case batch := <-out:
+				So(batch, ShouldResemble, []interface{}{1, 2})
+			case <-time.After(time.Second):
+				So("the batch to be emitted", ShouldBeNil)
+			}
+
+			close(in)
+			for range out {
+			}
+			So(<-errChan, ShouldBeNil)
+		})
+
+		Convey("emits the partial batch on abort if the next stage is ready", func() {
+			abort := make(chan chan error)
+			stage := &Stage{In: make(chan interface{}), Out: make(chan interface{}), Abort: abort}
+			done := make(chan error)
+			go func() { done <- NewBatcher(10, 0).Run(stage) }()
+
+			stage.In <- 1
+			received := make(chan interface{})
+			go func() { received <- <-stage.Out }()
+			time.Sleep(10 * time.Millisecond)
+			abort <- make(chan error)
+
+			So(<-done, ShouldBeNil)
+			So(<-received, ShouldResemble, []interface{}{1})
+		})
+	})
+
+	Convey("Unbatch", t, func() {
+		Convey("flattens batches of any type, passing other records through", func() {
+			So(collect(StreamFrom(from([]interface{}{1, 2}, []string{"a", "b"}, 3, []byte("c"))).Unbatch()), ShouldResemble, []interface{}{
+				1, 2, "a", "b", 3, []byte("c"),
+			})
+		})
+
+		Convey("undoes Batch", func() {
+			So(collect(StreamFrom(from(1, 2, 3)).Batch(2, time.Second).Unbatch()), ShouldResemble, []interface{}{1, 2, 3})
+		})
+
+		Convey("stops emitting a batch on abort", func() {
+			abort := make(chan chan error)
+			stage := &Stage{In: make(chan interface{}), Out: make(chan interface{}), Abort: abort}
+			done := make(chan error)
+			go func() { done <- NewUnbatcher().Run(stage) }()
+
+			stage.In <- []interface{}{1, 2, 3}
+			So(<-stage.Out, ShouldEqual, 1)
+			abort <- make(chan error)
+			So(<-done, ShouldBeNil)
+		})
+	})
+}
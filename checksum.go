@@ -0,0 +1,200 @@
+package ingest
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// sidecarLists are the checksum lists which are looked for in the directory of a file, along
+// with the kind of checksum they contain
+var sidecarLists = []struct {
+	name string
+	kind string
+}{
+	{"SHA256SUMS", "SHA256"},
+	{"MD5SUMS", "MD5"},
+}
+
+type (
+	// checksum is the expected or computed checksum of a file. Empty digests are unknown, as is
+	// a negative size
+	checksum struct {
+		sha256 string
+		md5    string
+		size   int64
+	}
+
+	// checksummer computes the checksum of the bytes written to it
+	checksummer struct {
+		sha256 hash.Hash
+		md5    hash.Hash
+		size   int64
+	}
+
+	// verifyingReader checksums the file read through it, failing once it is read to the end if
+	// the checksum isn't the one expected
+	verifyingReader struct {
+		io.ReadCloser
+		path     string
+		expect   checksum
+		computed *checksummer
+
+		// onVerified is called with the SHA256 of the file once it has been verified
+		onVerified func(sha256 string)
+	}
+)
+
+// newChecksummer builds a checksummer computing the digests needed to verify expect
+func newChecksummer(expect checksum) *checksummer {
+	sum := &checksummer{sha256: sha256.New()}
+	if expect.md5 != "" {
+		sum.md5 = md5.New()
+	}
+	return sum
+}
+
+// Write implements io.Writer for checksummer
+func (c *checksummer) Write(p []byte) (int, error) {
+	c.sha256.Write(p)
+	if c.md5 != nil {
+		c.md5.Write(p)
+	}
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+// checksum returns the checksum of everything written so far
+func (c *checksummer) checksum() checksum {
+	sum := checksum{sha256: hex.EncodeToString(c.sha256.Sum(nil)), size: c.size}
+	if c.md5 != nil {
+		sum.md5 = hex.EncodeToString(c.md5.Sum(nil))
+	}
+	return sum
+}
+
+// verify checks that the computed checksum is the one expected of the file at filePath
+func (c checksum) verify(filePath string, expect checksum) error {
+	if expect.size >= 0 && c.size != expect.size {
+		return fmt.Errorf("%s has a size of %d bytes, but %d bytes were expected", filePath, c.size, expect.size)
+	}
+	if expect.sha256 != "" && !strings.EqualFold(c.sha256, expect.sha256) {
+		return fmt.Errorf("%s has a SHA256 of %s, but %s was expected", filePath, c.sha256, expect.sha256)
+	}
+	if expect.md5 != "" && !strings.EqualFold(c.md5, expect.md5) {
+		return fmt.Errorf("%s has an MD5 of %s, but %s was expected", filePath, c.md5, expect.md5)
+	}
+	return nil
+}
+
+// verifyOnDisk checksums a file that has been opened from disk, leaving it ready to be read from
+// the start. The SHA256 of the File is set if it matches what was expected
+func verifyOnDisk(file *File, osFile *os.File, sourcePath string, expect checksum) error {
+	computed := newChecksummer(expect)
+	if _, err := io.Copy(computed, osFile); err != nil {
+		return err
+	}
+	if _, err := osFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	sum := computed.checksum()
+	if err := sum.verify(sourcePath, expect); err != nil {
+		return err
+	}
+	file.SHA256 = sum.sha256
+	return nil
+}
+
+// newVerifyingReader checksums the file at filePath as it is read from rc
+func newVerifyingReader(rc io.ReadCloser, filePath string, expect checksum, onVerified func(sha256 string)) *verifyingReader {
+	return &verifyingReader{
+		ReadCloser: rc,
+		path:       filePath,
+		expect:     expect,
+		computed:   newChecksummer(expect),
+		onVerified: onVerified,
+	}
+}
+
+// Read implements io.Reader for verifyingReader
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.computed.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	sum := v.computed.checksum()
+	if verifyErr := sum.verify(v.path, v.expect); verifyErr != nil {
+		return n, verifyErr
+	}
+	if v.onVerified != nil {
+		v.onVerified(sum.sha256)
+		v.onVerified = nil
+	}
+	return n, err
+}
+
+// isSidecar checks whether the file is a checksum of other files
+func isSidecar(filePath string) bool {
+	_, name := splitDir(filePath)
+	if strings.HasSuffix(strings.ToLower(name), ".sha256") {
+		return true
+	}
+	for _, list := range sidecarLists {
+		if name == list.name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDir splits a local path or URL into its directory and the name of the file, keeping the
+// separator on the directory
+func splitDir(filePath string) (dir string, name string) {
+	i := strings.LastIndexAny(filePath, "/"+string(os.PathSeparator))
+	return filePath[:i+1], filePath[i+1:]
+}
+
+// readSidecar reads a checksum file from the FileSystem, returning whether it exists
+func readSidecar(fileSystem FileSystem, filePath string) ([]string, bool, error) {
+	rc, err := fileSystem.Open(filePath)
+	if isNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, true, scanner.Err()
+}
+
+// parseChecksumList parses the lines of a SHA256SUMS or MD5SUMS file into the digests of each file
+// by name. Binary mode entries (*name) and leading directories (./name) are accepted
+func parseChecksumList(lines []string) map[string]string {
+	digests := map[string]string{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		digests[path.Base(name)] = strings.ToLower(fields[0])
+	}
+	return digests
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	sha256Of := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	md5Of := func(content string) string {
+		sum := md5.Sum([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// collect runs the Opener, returning the files it emitted by name with their contents read
+	collect := func(opener *Opener) (map[string]*File, error) {
+		out := make(chan interface{})
+		errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
+
+		files := map[string]*File{}
+		var readErr error
+		for rec := range out {
+			file := rec.(*File)
+			if _, err := ioutil.ReadAll(file); err != nil && readErr == nil {
+				readErr = err
+			}
+			file.Close()
+			files[file.Name] = file
+		}
+		if err := <-errChan; err != nil {
+			return files, err
+		}
+		return files, readErr
+	}
+
+	Convey("Checksums", t, func() {
+		Convey("parses SHA256SUMS and MD5SUMS files", func() {
+			digests := parseChecksumList([]string{
+				"ABC123  people.csv",
+				"def456 *./nested/places.csv",
+				"malformed",
+			})
+			So(digests, ShouldResemble, map[string]string{"people.csv": "abc123", "places.csv": "def456"})
+		})
+
+		Convey("recognizes sidecar files", func() {
+			So(isSidecar("data/people.csv.sha256"), ShouldBeTrue)
+			So(isSidecar("s3://bucket/SHA256SUMS"), ShouldBeTrue)
+			So(isSidecar("MD5SUMS"), ShouldBeTrue)
+			So(isSidecar("data/people.csv"), ShouldBeFalse)
+		})
+
+		Convey("splits URLs and paths into directories", func() {
+			dir, name := splitDir("s3://bucket/data/people.csv")
+			So(dir, ShouldEqual, "s3://bucket/data/")
+			So(name, ShouldEqual, "people.csv")
+
+			dir, name = splitDir("people.csv")
+			So(dir, ShouldEqual, "")
+			So(name, ShouldEqual, "people.csv")
+		})
+
+		Convey("Opening local files", func() {
+			dir, err := ioutil.TempDir("", "ingest-checksum-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			write := func(name string, content string) string {
+				filePath := filepath.Join(dir, name)
+				So(ioutil.WriteFile(filePath, []byte(content), 0644), ShouldBeNil)
+				return filePath
+			}
+			people := write("people.csv", "name\nada\n")
+
+			Convey("records the SHA256 of files matching ExpectSHA256", func() {
+				files, err := collect(NewOpener(people, OpenOpts{ExpectSHA256: sha256Of("name\nada\n"), ExpectSize: 9}))
+				So(err, ShouldBeNil)
+				So(files["people.csv"].SHA256, ShouldEqual, sha256Of("name\nada\n"))
+			})
+
+			Convey("fails on a SHA256 mismatch", func() {
+				files, err := collect(NewOpener(people, OpenOpts{ExpectSHA256: sha256Of("other")}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "SHA256")
+				So(files, ShouldBeEmpty)
+			})
+
+			Convey("fails on a size mismatch", func() {
+				_, err := collect(NewOpener(people, OpenOpts{ExpectSize: 100}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "100 bytes")
+			})
+
+			Convey("verifies directories against their sidecars", func() {
+				write("people.csv.sha256", sha256Of("name\nada\n")+"  people.csv\n")
+				write("places.csv", "name\nparis\n")
+				write("things.csv", "name\nkettle\n")
+				write("unlisted.csv", "name\n")
+				write("SHA256SUMS", sha256Of("name\nparis\n")+"  places.csv\n")
+				write("MD5SUMS", md5Of("name\nkettle\n")+"  things.csv\n")
+
+				files, err := collect(NewOpener(dir, OpenOpts{VerifySidecars: true}))
+				So(err, ShouldBeNil)
+				So(files, ShouldHaveLength, 4)
+				So(files["people.csv"].SHA256, ShouldEqual, sha256Of("name\nada\n"))
+				So(files["places.csv"].SHA256, ShouldEqual, sha256Of("name\nparis\n"))
+				So(files["things.csv"].SHA256, ShouldEqual, sha256Of("name\nkettle\n"))
+				So(files["unlisted.csv"].SHA256, ShouldEqual, sha256Of("name\n"))
+
+				Convey("and fails if one doesn't match", func() {
+					write("MD5SUMS", md5Of("name\nteapot\n")+"  things.csv\n")
+					_, err := collect(NewOpener(dir, OpenOpts{VerifySidecars: true}))
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "MD5")
+				})
+			})
+		})
+
+		Convey("Opening remote files", func() {
+			mem := NewMemFileSystem()
+			mem.WriteFile("memsum://drop/people.csv", []byte("name\nada\n"))
+			mem.WriteFile("memsum://drop/people.csv.sha256", []byte(sha256Of("name\nada\n")))
+			mem.WriteFile("memsum://drop/places.csv", []byte("name\nparis\n"))
+			mem.WriteFile("memsum://drop/SHA256SUMS", []byte(sha256Of("name\nrome\n")+"  places.csv\n"))
+			RegisterFileSystem("memsum", mem)
+
+			Convey("verifies streamed files as they are read", func() {
+				files, err := collect(NewOpener("memsum://drop/people.csv", OpenOpts{VerifySidecars: true}))
+				So(err, ShouldBeNil)
+				So(files["people.csv"].SHA256, ShouldEqual, sha256Of("name\nada\n"))
+			})
+
+			Convey("fails to read streamed files that don't match", func() {
+				files, err := collect(NewOpener("memsum://drop/places.csv", OpenOpts{VerifySidecars: true}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "SHA256")
+				So(files["places.csv"].SHA256, ShouldBeEmpty)
+			})
+
+			Convey("verifies files downloaded to TempDir before emitting them", func() {
+				opts := OpenOpts{VerifySidecars: true, TempDir: "test/tmp-checksum"}
+				Reset(func() { os.RemoveAll("test/tmp-checksum") })
+
+				files, err := collect(NewOpener("memsum://drop/people.csv", opts))
+				So(err, ShouldBeNil)
+				So(files["people.csv"].SHA256, ShouldEqual, sha256Of("name\nada\n"))
+
+				files, err = collect(NewOpener("memsum://drop", opts))
+				So(err, ShouldNotBeNil)
+				So(files, ShouldHaveLength, 1)
+				So(files, ShouldContainKey, "people.csv")
+
+				left, err := ioutil.ReadDir("test/tmp-checksum")
+				So(err, ShouldBeNil)
+				So(left, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package ingest
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+type (
+	// download is a file being downloaded to TempDir by emitConcurrently
+	download struct {
+		info     FileInfo
+		file     *File
+		err      error
+		progress *ProgressTracker
+		done     chan struct{}
+		emitted  bool
+
+		// released is set once the download has given up its slot
+		released bool
+	}
+
+	// bandwidthLimiter shares a budget of bytes per second between readers
+	bandwidthLimiter struct {
+		mu             sync.Mutex
+		bytesPerSecond int64
+
+		// next is when the bytes already read are paid for
+		next time.Time
+	}
+
+	// throttledReader waits after each read until its bytes fit within the bandwidth budget
+	throttledReader struct {
+		io.ReadCloser
+		limiter *bandwidthLimiter
+	}
+)
+
+// emitConcurrently downloads up to Opts.Concurrency of the files to TempDir at once. Each file is emitted
+// as soon as it has been downloaded, or in the order they are listed in if Opts.KeepOrder is set
+//
+// A download keeps its slot until it has been emitted, so that at most Opts.Concurrency files are
+// downloaded ahead of the next stage
+func (o *Opener) emitConcurrently(fileSystem FileSystem, files []FileInfo, stage *Stage) error {
+	// Closing cancel aborts every download in progress
+	cancel := make(chan chan error)
+	var cancelOnce sync.Once
+	stop := func() { cancelOnce.Do(func() { close(cancel) }) }
+
+	started := make(chan *download, len(files))
+	finished := make(chan *download, len(files))
+	slots := make(chan struct{}, o.Opts.Concurrency)
+	release := func(d *download) {
+		if !d.released {
+			d.released = true
+			<-slots
+		}
+	}
+
+	var wg sync.WaitGroup
+	go func() {
+		defer func() {
+			close(started)
+			wg.Wait()
+			close(finished)
+		}()
+
+		for _, info := range files {
+			select {
+			case <-cancel:
+				return
+			case slots <- struct{}{}:
+			}
+			select {
+			case <-cancel:
+				<-slots
+				return
+			default:
+			}
+
+			d := &download{info: info, done: make(chan struct{})}
+			started <- d
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.file, d.progress, d.err = o.download(fileSystem, d.info, stage, cancel)
+				close(d.done)
+				finished <- d
+			}()
+		}
+	}()
+
+	// Files that weren't emitted are closed once everything has stopped
+	defer func() {
+		stop()
+		go func() {
+			for d := range finished {
+				if !d.emitted && d.file != nil {
+					d.file.Close()
+				}
+				release(d)
+			}
+		}()
+	}()
+
+	next := finished
+	if o.Opts.KeepOrder {
+		next = started
+	}
+	for d := range next {
+		select {
+		case <-stage.Abort:
+			return nil
+		case <-d.done:
+		}
+
+		switch {
+		case d.err == ErrNotModified:
+			o.logger.WithField("file", d.info.Path).Info("Skipping unchanged file")
+			release(d)
+			continue
+		case d.err == errAborted:
+			return nil
+		case d.err != nil:
+			return d.err
+		}
+
+		select {
+		case <-stage.Abort:
+			return nil
+		case stage.Out <- d.file:
+			d.emitted = true
+			d.progress.AddRecords(1)
+			release(d)
+		}
+	}
+	return nil
+}
+
+// download opens a remote file and downloads it to TempDir, reporting its progress to the stage
+func (o *Opener) download(fileSystem FileSystem, info FileInfo, stage *Stage, abort <-chan chan error) (*File, *ProgressTracker, error) {
+	rc, info, err := o.openRemote(fileSystem, info, abort)
+	if err != nil {
+		return nil, nil, err
+	}
+	progress := stage.TrackProgress(info.Path, info.Size)
+	file, err := o.prepareRemote(fileSystem, progress.ReadCloser(rc), info, abort)
+	return file, progress, err
+}
+
+// newBandwidthLimiter builds a bandwidthLimiter allowing bytesPerSecond
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until n more bytes fit within the budget
+func (b *bandwidthLimiter) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.bytesPerSecond))
+	delay := b.next.Sub(now)
+	b.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// Read implements io.Reader for throttledReader
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.limiter.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,180 @@
+package ingest
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowFileSystem delays opening files on a MemFileSystem, tracking how many are open at once
+type slowFileSystem struct {
+	*MemFileSystem
+	delays map[string]time.Duration
+
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+}
+
+// slowFile is a file opened by a slowFileSystem
+type slowFile struct {
+	io.ReadCloser
+	fileSystem *slowFileSystem
+	once       sync.Once
+}
+
+func (s *slowFileSystem) Open(path string) (io.ReadCloser, error) {
+	rc, err := s.MemFileSystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.open++
+	if s.open > s.maxOpen {
+		s.maxOpen = s.open
+	}
+	s.mu.Unlock()
+
+	time.Sleep(s.delays[path])
+	return &slowFile{ReadCloser: rc, fileSystem: s}, nil
+}
+
+func (f *slowFile) Close() error {
+	f.once.Do(func() {
+		f.fileSystem.mu.Lock()
+		f.fileSystem.open--
+		f.fileSystem.mu.Unlock()
+	})
+	return f.ReadCloser.Close()
+}
+
+func TestConcurrentDownloads(t *testing.T) {
+	Convey("Downloading listed files concurrently", t, func() {
+		mem := NewMemFileSystem()
+		for _, name := range []string{"a.csv", "b.csv", "c.csv", "d.csv"} {
+			mem.WriteFile("memslow://drop/"+name, bytes.Repeat([]byte(name[:1]), 1000))
+		}
+		slow := &slowFileSystem{
+			MemFileSystem: mem,
+			delays: map[string]time.Duration{
+				"memslow://drop/a.csv": 150 * time.Millisecond,
+				"memslow://drop/b.csv": 50 * time.Millisecond,
+				"memslow://drop/c.csv": 50 * time.Millisecond,
+				"memslow://drop/d.csv": 50 * time.Millisecond,
+			},
+		}
+		RegisterFileSystem("memslow", slow)
+		Reset(func() { os.RemoveAll("test/tmp-concurrent") })
+
+		// collect runs the Opener, returning the names of the files it emitted in order
+		collect := func(opts OpenOpts) ([]string, error) {
+			opts.TempDir = "test/tmp-concurrent"
+			out := make(chan interface{})
+			errChan := NewPipeline().Then(NewOpener("memslow://drop", opts)).StreamTo(out).Build().RunAsync()
+
+			names := []string{}
+			for rec := range out {
+				file := rec.(*File)
+				content, _ := ioutil.ReadAll(file)
+				file.Close()
+				So(content, ShouldHaveLength, 1000)
+				names = append(names, file.Name)
+			}
+			return names, <-errChan
+		}
+
+		Convey("downloads several files at once", func() {
+			names, err := collect(OpenOpts{Concurrency: 2})
+			So(err, ShouldBeNil)
+			So(names, ShouldHaveLength, 4)
+			So(names, ShouldContain, "a.csv")
+			So(names[0], ShouldNotEqual, "a.csv")
+			So(slow.maxOpen, ShouldEqual, 2)
+		})
+
+		Convey("emits them in order with KeepOrder", func() {
+			names, err := collect(OpenOpts{Concurrency: 3, KeepOrder: true})
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"a.csv", "b.csv", "c.csv", "d.csv"})
+			So(slow.maxOpen, ShouldEqual, 3)
+		})
+
+		Convey("doesn't download more than Concurrency files ahead of the next stage", func() {
+			slow.delays = nil
+			for _, name := range []string{"e.csv", "f.csv", "g.csv", "h.csv"} {
+				mem.WriteFile("memslow://drop/"+name, bytes.Repeat([]byte(name[:1]), 1000))
+			}
+
+			opener := NewOpener("memslow://drop", OpenOpts{TempDir: "test/tmp-concurrent", Concurrency: 2})
+			abort := make(chan chan error)
+			done := make(chan error, 1)
+			go func() { done <- opener.Run(&Stage{Out: make(chan interface{}), Abort: abort}) }()
+			time.Sleep(100 * time.Millisecond)
+
+			downloaded := 0
+			filepath.Walk("test/tmp-concurrent", func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					downloaded++
+				}
+				return nil
+			})
+			So(downloaded, ShouldEqual, 2)
+
+			abort <- make(chan error, 1)
+			So(<-done, ShouldBeNil)
+			So(opener.OnPipelineDone(), ShouldBeNil)
+		})
+
+		Convey("downloads one at a time by default", func() {
+			names, err := collect(OpenOpts{})
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"a.csv", "b.csv", "c.csv", "d.csv"})
+			So(slow.maxOpen, ShouldEqual, 1)
+		})
+
+		Convey("shares the bandwidth budget between downloads", func() {
+			slow.delays = nil
+			started := time.Now()
+			names, err := collect(OpenOpts{Concurrency: 4, BytesPerSecond: 20000})
+			So(err, ShouldBeNil)
+			So(names, ShouldHaveLength, 4)
+			So(time.Since(started), ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+		})
+
+		Convey("fails if a download fails", func() {
+			mem.Remove("memslow://drop/c.csv")
+			slow.delays = nil
+			RegisterFileSystem("memslow", &failingListFileSystem{slow})
+			_, err := collect(OpenOpts{Concurrency: 2, Retries: -1})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A bandwidthLimiter", t, func() {
+		limiter := newBandwidthLimiter(10000)
+
+		Convey("waits for the bytes read to fit in the budget", func() {
+			started := time.Now()
+			limiter.wait(500)
+			limiter.wait(500)
+			So(time.Since(started), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+		})
+	})
+}
+
+// failingListFileSystem lists c.csv even though it can't be opened
+type failingListFileSystem struct {
+	*slowFileSystem
+}
+
+func (f *failingListFileSystem) List(path string) ([]FileInfo, error) {
+	files, err := f.slowFileSystem.List(path)
+	return append(files, FileInfo{Path: "memslow://drop/c.csv", Size: -1}), err
+}
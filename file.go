@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urbint/ingest/utils"
+)
+
+// contentTypes are the content types of common data formats, which aren't all known to the mime package
+var contentTypes = map[string]string{
+	".csv":     "text/csv",
+	".tsv":     "text/tab-separated-values",
+	".txt":     "text/plain",
+	".json":    "application/json",
+	".geojson": "application/geo+json",
+	".jsonl":   "application/x-ndjson",
+	".ndjson":  "application/x-ndjson",
+	".xml":     "application/xml",
+	".yaml":    "application/x-yaml",
+	".yml":     "application/x-yaml",
+	".toml":    "application/toml",
+	".zip":     "application/zip",
+	".tar":     "application/x-tar",
+	".gz":      "application/gzip",
+	".tgz":     "application/gzip",
+	".bz2":     "application/x-bzip2",
+	".xz":      "application/x-xz",
+}
+
+// A File is emitted by the Opener and the process runners. It reads the contents of the file and
+// describes where it came from, so that later stages can tell files apart
+type File struct {
+	io.ReadCloser
+
+	// Name is the base name of the file, ie. people.csv
+	Name string
+
+	// Path is the path of the file as it was opened, or its path within the archive containing it
+	Path string
+
+	// Size is the size of the file in bytes, or -1 if it is unknown
+	Size int64
+
+	// ModTime is the modification time of the file, if known
+	ModTime time.Time
+
+	// ContentType is the MIME type of the file, detected from its extension
+	ContentType string
+
+	// SourceURL is the URL a remote file was opened from
+	SourceURL string
+
+	// SHA256 is the hex encoded SHA256 of the contents, if the Opener verified the file. Files that
+	// are streamed only have it once they have been read to the end
+	SHA256 string
+
+	// Parent is the archive or compressed file that the file was extracted from, if any
+	Parent *File
+}
+
+// A SourceFileSetter is a mapper that is told which File each of its records was parsed from.
+// It must be implemented with a pointer receiver
+type SourceFileSetter interface {
+	SetSourceFile(file *File)
+}
+
+// NewFile builds a File which reads from rc, named by its path. Its Size is unknown and its
+// ContentType is detected from the extension of path
+func NewFile(rc io.ReadCloser, filePath string) *File {
+	return &File{
+		ReadCloser:  rc,
+		Name:        path.Base(filepath.ToSlash(filePath)),
+		Path:        filePath,
+		Size:        -1,
+		ContentType: ContentTypeOf(filePath),
+	}
+}
+
+// fileFromOS builds a File for an opened *os.File
+func fileFromOS(file *os.File, info os.FileInfo) *File {
+	result := NewFile(file, file.Name())
+	result.Size = info.Size()
+	result.ModTime = info.ModTime()
+	return result
+}
+
+// ContentTypeOf returns the MIME type of a file by the extension of its name, or an empty
+// string if it is unknown
+func ContentTypeOf(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if contentType, isKnown := contentTypes[ext]; isKnown {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// FileOf returns the input as a File. Inputs that aren't a File but are named
+// (ie. an *os.File) are described by their name. It returns nil for other inputs
+func FileOf(input interface{}) *File {
+	switch in := input.(type) {
+	case *File:
+		return in
+	case *os.File:
+		if info, err := in.Stat(); err == nil {
+			return fileFromOS(in, info)
+		}
+	}
+
+	filePath := PathOf(input)
+	if filePath == "" {
+		return nil
+	}
+	rc, _ := utils.ToIOReadCloser(input)
+	return NewFile(rc, filePath)
+}
+
+// PathOf returns the path of the input if it is a File, or the name of any other input with
+// a Name method (ie. an *os.File). Otherwise it returns an empty string
+func PathOf(input interface{}) string {
+	if file, isFile := input.(*File); isFile {
+		if file == nil {
+			return ""
+		}
+		return file.Path
+	}
+	if named, isNamed := input.(interface {
+		Name() string
+	}); isNamed {
+		return named.Name()
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	Convey("File", t, func() {
+		Convey("NewFile names the file by its path", func() {
+			file := NewFile(ioutil.NopCloser(strings.NewReader("a,b\n")), "data/2024/people.csv")
+			So(file.Name, ShouldEqual, "people.csv")
+			So(file.Path, ShouldEqual, "data/2024/people.csv")
+			So(file.Size, ShouldEqual, -1)
+			So(file.ContentType, ShouldEqual, "text/csv")
+
+			content, err := ioutil.ReadAll(file)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "a,b\n")
+		})
+
+		Convey("ContentTypeOf detects data formats", func() {
+			So(ContentTypeOf("people.JSON"), ShouldEqual, "application/json")
+			So(ContentTypeOf("archive.tar"), ShouldEqual, "application/x-tar")
+			So(ContentTypeOf("no-extension"), ShouldEqual, "")
+		})
+
+		Convey("FileOf", func() {
+			Convey("returns a File as is", func() {
+				file := NewFile(nil, "people.csv")
+				So(FileOf(file), ShouldEqual, file)
+			})
+
+			Convey("describes an os.File", func() {
+				osFile, err := os.Open("test/fixtures/dirtest/file2.txt")
+				So(err, ShouldBeNil)
+				defer osFile.Close()
+
+				file := FileOf(osFile)
+				So(file.Name, ShouldEqual, "file2.txt")
+				So(file.ReadCloser, ShouldEqual, osFile)
+				So(file.Size, ShouldBeGreaterThanOrEqualTo, 0)
+				So(file.ModTime.IsZero(), ShouldBeFalse)
+			})
+
+			Convey("returns nil for unnamed inputs", func() {
+				So(FileOf(strings.NewReader("")), ShouldBeNil)
+				So(PathOf(strings.NewReader("")), ShouldEqual, "")
+			})
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// A FileSystem opens, describes and lists the files at paths with a particular URL scheme.
+	// FileSystems are registered by scheme with RegisterFileSystem, and used by the Opener
+	FileSystem interface {
+		// Open opens the file at the path for reading
+		Open(path string) (io.ReadCloser, error)
+
+		// Stat describes the file or directory at the path
+		Stat(path string) (FileInfo, error)
+
+		// List returns every file within the directory (or prefix) at the path, including those
+		// in nested directories, in the lexical order of their paths
+		List(path string) ([]FileInfo, error)
+	}
+
+	// FileInfo describes a file or directory on a FileSystem
+	FileInfo struct {
+		// Path is the full path of the file, including its scheme if it has one
+		Path string
+
+		// Size is the size of the file in bytes, or -1 if it is unknown
+		Size int64
+
+		// ModTime is the modification time of the file, if known
+		ModTime time.Time
+
+		// IsDir is true for directories, and prefixes of other files
+		IsDir bool
+	}
+
+	// A ConditionalFileSystem is a FileSystem which can open part of a file, and skip opening
+	// files which haven't changed. The Opener uses it to resume interrupted reads
+	ConditionalFileSystem interface {
+		FileSystem
+
+		// OpenConditional opens the file as described by the request. It returns ErrNotModified
+		// if the file is still the version in request.IfChanged
+		OpenConditional(path string, request ConditionalRequest) (*ConditionalResponse, error)
+	}
+
+	// ConditionalRequest describes how a ConditionalFileSystem should open a file
+	ConditionalRequest struct {
+		// Offset is the byte to start reading the file from
+		Offset int64
+
+		// IfRange is the version of the file that was being read. If the file has changed since,
+		// it is sent from the start
+		IfRange Version
+
+		// IfChanged is a version of the file that has already been read, which shouldn't be
+		// opened again
+		IfChanged Version
+	}
+
+	// ConditionalResponse is a file opened by a ConditionalFileSystem
+	ConditionalResponse struct {
+		io.ReadCloser
+
+		// Offset is the byte the file is being read from, which is 0 if the whole file was sent
+		Offset int64
+
+		// Size is the size of the whole file in bytes, or -1 if it is unknown
+		Size int64
+
+		// Version is the version of the file that was opened
+		Version Version
+	}
+
+	// Version identifies the version of a remote file by the validators sent with it
+	Version struct {
+		ETag         string `json:"etag,omitempty"`
+		LastModified string `json:"lastModified,omitempty"`
+	}
+
+	// LocalFileSystem is the FileSystem for paths on the local disk, which may be prefixed
+	// with file://
+	LocalFileSystem struct{}
+)
+
+// ErrNotModified is returned by a ConditionalFileSystem when a file hasn't changed
+var ErrNotModified = errors.New("File has not been modified")
+
+var (
+	fileSystemsMu sync.RWMutex
+	fileSystems   = map[string]FileSystem{
+		"":      LocalFileSystem{},
+		"file":  LocalFileSystem{},
+		"http":  &HTTPFileSystem{},
+		"https": &HTTPFileSystem{},
+		"s3":    &S3FileSystem{},
+	}
+)
+
+// RegisterFileSystem sets the FileSystem used to open paths with the URL scheme (ie. s3 for
+// s3://bucket/key), replacing any FileSystem already registered for it. Local paths without
+// a scheme use the empty scheme
+func RegisterFileSystem(scheme string, fileSystem FileSystem) {
+	fileSystemsMu.Lock()
+	defer fileSystemsMu.Unlock()
+	fileSystems[strings.ToLower(scheme)] = fileSystem
+}
+
+// FileSystemFor returns the FileSystem registered for the URL scheme of the path
+func FileSystemFor(path string) (FileSystem, error) {
+	scheme := schemeOf(path)
+
+	fileSystemsMu.RLock()
+	defer fileSystemsMu.RUnlock()
+	fileSystem, isRegistered := fileSystems[scheme]
+	if !isRegistered {
+		return nil, fmt.Errorf("No FileSystem is registered for %s://", scheme)
+	}
+	return fileSystem, nil
+}
+
+// schemeOf returns the lower case URL scheme of the path, or an empty string if it has none
+func schemeOf(path string) string {
+	if i := strings.Index(path, "://"); i > 0 {
+		return strings.ToLower(path[:i])
+	}
+	return ""
+}
+
+// IsZero checks whether the version has no validators
+func (v Version) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// Matches checks whether two versions are of the same file. Versions without a validator
+// in common are assumed to match
+func (v Version) Matches(other Version) bool {
+	if v.ETag != "" && other.ETag != "" {
+		return v.ETag == other.ETag
+	}
+	if v.LastModified != "" && other.LastModified != "" {
+		return v.LastModified == other.LastModified
+	}
+	return true
+}
+
+// localPath strips any file:// prefix from the path
+func localPath(path string) string {
+	if schemeOf(path) == "file" {
+		return path[len("file://"):]
+	}
+	return path
+}
+
+// Open implements FileSystem for LocalFileSystem, returning an *os.File
+func (LocalFileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(localPath(path))
+}
+
+// Stat implements FileSystem for LocalFileSystem
+func (LocalFileSystem) Stat(path string) (FileInfo, error) {
+	info, err := os.Stat(localPath(path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return localFileInfo(localPath(path), info), nil
+}
+
+// List implements FileSystem for LocalFileSystem
+func (LocalFileSystem) List(path string) ([]FileInfo, error) {
+	var files []FileInfo
+	err := filepath.WalkDir(localPath(path), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, localFileInfo(filePath, info))
+		return nil
+	})
+	return files, err
+}
+
+func localFileInfo(path string, info os.FileInfo) FileInfo {
+	return FileInfo{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+// isNotFound checks whether an error is a FileSystem reporting that a path doesn't exist
+func isNotFound(err error) bool {
+	statusErr, isStatusErr := err.(*HTTPStatusError)
+	return os.IsNotExist(err) || (isStatusErr && statusErr.StatusCode == http.StatusNotFound)
+}
+
+// isStatUnsupported checks whether a failed Stat may still be opened, as the path wasn't found or
+// the server doesn't support HEAD requests. Other errors, such as being denied, fail the Open too
+func isStatUnsupported(err error) bool {
+	if isNotFound(err) {
+		return true
+	}
+	statusErr, isStatusErr := err.(*HTTPStatusError)
+	return isStatusErr && (statusErr.StatusCode == http.StatusMethodNotAllowed || statusErr.StatusCode == http.StatusNotImplemented)
+}
@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// HTTPFileSystem is the FileSystem for http:// and https:// URLs. It can't list directories.
+	// It is a ConditionalFileSystem, using range requests to resume interrupted reads and
+	// ETag / Last-Modified validators to skip unchanged files
+	HTTPFileSystem struct {
+		// Client is the client used for requests. Defaults to http.DefaultClient
+		Client *http.Client
+	}
+
+	// HTTPStatusError is returned when a server responds with an unexpected status
+	HTTPStatusError struct {
+		URL        string
+		StatusCode int
+		Status     string
+	}
+)
+
+// Error implements error for HTTPStatusError
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("Failed to open %s: %s", e.URL, e.Status)
+}
+
+// Temporary checks whether the request may succeed if it is retried
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func (h *HTTPFileSystem) client() *http.Client {
+	if h.Client == nil {
+		return http.DefaultClient
+	}
+	return h.Client
+}
+
+// Open implements FileSystem for HTTPFileSystem
+func (h *HTTPFileSystem) Open(url string) (io.ReadCloser, error) {
+	resp, err := h.OpenConditional(url, ConditionalRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.ReadCloser, nil
+}
+
+// OpenConditional implements ConditionalFileSystem for HTTPFileSystem
+func (h *HTTPFileSystem) OpenConditional(url string, request ConditionalRequest) (*ConditionalResponse, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if request.Offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", request.Offset))
+
+		// Weak ETags can't be used to resume
+		if etag := request.IfRange.ETag; etag != "" && !strings.HasPrefix(etag, "W/") {
+			req.Header.Set("If-Range", etag)
+		} else if request.IfRange.LastModified != "" {
+			req.Header.Set("If-Range", request.IfRange.LastModified)
+		}
+	}
+	if request.IfChanged.ETag != "" {
+		req.Header.Set("If-None-Match", request.IfChanged.ETag)
+	}
+	if request.IfChanged.LastModified != "" {
+		req.Header.Set("If-Modified-Since", request.IfChanged.LastModified)
+	}
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := &ConditionalResponse{
+		ReadCloser: resp.Body,
+		Size:       resp.ContentLength,
+		Version:    Version{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")},
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return opened, nil
+	case http.StatusPartialContent:
+		// The total size is * if the server doesn't know it
+		var end int64
+		contentRange := resp.Header.Get("Content-Range")
+		if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &opened.Offset, &end, &opened.Size); err != nil {
+			opened.Size = -1
+			if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/*", &opened.Offset, &end); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("Failed to open %s: invalid Content-Range %q", url, contentRange)
+			}
+		}
+		return opened, nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, ErrNotModified
+	default:
+		resp.Body.Close()
+		return nil, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+}
+
+// Stat implements FileSystem for HTTPFileSystem with a HEAD request
+func (h *HTTPFileSystem) Stat(url string) (FileInfo, error) {
+	resp, err := h.client().Head(url)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return FileInfo{}, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return FileInfo{Path: url, Size: resp.ContentLength, ModTime: lastModified(resp.Header)}, nil
+}
+
+// List implements FileSystem for HTTPFileSystem, which always fails
+func (h *HTTPFileSystem) List(url string) ([]FileInfo, error) {
+	return nil, fmt.Errorf("HTTP doesn't support listing %s", url)
+}
+
+// lastModified parses the Last-Modified header of a response, returning the zero time if it
+// is missing or malformed
+func lastModified(header http.Header) time.Time {
+	modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+	return modTime
+}
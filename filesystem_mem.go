@@ -0,0 +1,96 @@
+package ingest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// MemFileSystem is a FileSystem which keeps its files in memory, useful in tests.
+	// Directories are implied by the paths of the files within them
+	MemFileSystem struct {
+		mu    sync.RWMutex
+		files map[string]memFile
+	}
+
+	memFile struct {
+		contents []byte
+		modTime  time.Time
+	}
+)
+
+// NewMemFileSystem builds an empty MemFileSystem. Register it to open its files by path,
+// ie. RegisterFileSystem("mem", fileSystem)
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{files: map[string]memFile{}}
+}
+
+// WriteFile sets the contents of the file at the path, and its modification time to now
+func (m *MemFileSystem) WriteFile(path string, contents []byte) {
+	m.WriteFileAt(path, contents, time.Now())
+}
+
+// WriteFileAt sets the contents and the modification time of the file at the path
+func (m *MemFileSystem) WriteFileAt(path string, contents []byte, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = memFile{contents: contents, modTime: modTime}
+}
+
+// Remove removes the file at the path, if it exists
+func (m *MemFileSystem) Remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, path)
+}
+
+// Open implements FileSystem for MemFileSystem
+func (m *MemFileSystem) Open(path string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, exists := m.files[path]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(file.contents)), nil
+}
+
+// Stat implements FileSystem for MemFileSystem
+func (m *MemFileSystem) Stat(path string) (FileInfo, error) {
+	m.mu.RLock()
+	file, exists := m.files[path]
+	m.mu.RUnlock()
+
+	if exists {
+		return FileInfo{Path: path, Size: int64(len(file.contents)), ModTime: file.modTime}, nil
+	}
+
+	files, _ := m.List(path)
+	if len(files) == 0 {
+		return FileInfo{}, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return FileInfo{Path: path, Size: -1, IsDir: true}, nil
+}
+
+// List implements FileSystem for MemFileSystem
+func (m *MemFileSystem) List(path string) ([]FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	var files []FileInfo
+	for filePath, file := range m.files {
+		if strings.HasPrefix(filePath, prefix) {
+			files = append(files, FileInfo{Path: filePath, Size: int64(len(file.contents)), ModTime: file.modTime})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
@@ -0,0 +1,352 @@
+package ingest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the hex encoded SHA256 of an empty request body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type (
+	// S3FileSystem is the FileSystem for s3://bucket/key URLs. Prefixes of keys are treated
+	// as directories.
+	//
+	// Requests are signed with the credentials set on it, or else those in the AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables. Without any credentials
+	// requests are sent anonymously, which works for public buckets
+	S3FileSystem struct {
+		// Region is the region of the buckets. Defaults to the AWS_REGION or AWS_DEFAULT_REGION
+		// environment variables, or else us-east-1
+		Region string
+
+		// Endpoint is the URL of an S3 compatible service (ie. http://localhost:9000), whose
+		// buckets are addressed by path. Defaults to AWS
+		Endpoint string
+
+		// AccessKeyID, SecretAccessKey and SessionToken are the credentials to sign requests with
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+
+		// Client is the client used for requests. Defaults to http.DefaultClient
+		Client *http.Client
+	}
+
+	// s3ListResult is the response to a ListObjectsV2 request
+	s3ListResult struct {
+		Contents []struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+)
+
+// Open implements FileSystem for S3FileSystem
+func (s *S3FileSystem) Open(path string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3Path(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do("GET", bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp, "open", path)
+	}
+	return resp.Body, nil
+}
+
+// Stat implements FileSystem for S3FileSystem. Paths which aren't an object but are the prefix
+// of other objects are directories
+func (s *S3FileSystem) Stat(path string) (FileInfo, error) {
+	bucket, key, err := parseS3Path(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	if key != "" && !strings.HasSuffix(key, "/") {
+		resp, err := s.do("HEAD", bucket, key, nil)
+		if err != nil {
+			return FileInfo{}, err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return FileInfo{Path: path, Size: resp.ContentLength, ModTime: lastModified(resp.Header)}, nil
+		case http.StatusNotFound:
+		default:
+			return FileInfo{}, s3Error(resp, "stat", path)
+		}
+	}
+
+	result, err := s.listPage(bucket, s3Prefix(key), "", 1)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if len(result.Contents) == 0 {
+		return FileInfo{}, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return FileInfo{Path: path, Size: -1, IsDir: true}, nil
+}
+
+// List implements FileSystem for S3FileSystem, listing every object with the path as a prefix
+func (s *S3FileSystem) List(path string) ([]FileInfo, error) {
+	bucket, key, err := parseS3Path(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	token := ""
+	for {
+		result, err := s.listPage(bucket, s3Prefix(key), token, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			// Skip the empty objects some tools create to mark directories
+			if strings.HasSuffix(object.Key, "/") {
+				continue
+			}
+			files = append(files, FileInfo{
+				Path:    "s3://" + bucket + "/" + object.Key,
+				Size:    object.Size,
+				ModTime: object.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// listPage requests a single page of the objects in the bucket with the prefix. maxKeys is
+// left to the server if it is zero
+func (s *S3FileSystem) listPage(bucket string, prefix string, token string, maxKeys int) (*s3ListResult, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", fmt.Sprint(maxKeys))
+	}
+
+	resp, err := s.do("GET", bucket, "", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp, "list", "s3://"+bucket+"/"+prefix)
+	}
+
+	result := &s3ListResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// do sends a signed request for the key in the bucket
+func (s *S3FileSystem) do(method string, bucket string, key string, query url.Values) (*http.Response, error) {
+	var rawURL string
+	if s.Endpoint != "" {
+		rawURL = strings.TrimSuffix(s.Endpoint, "/") + "/" + s3Escape(bucket, true)
+		if key != "" {
+			rawURL += "/" + s3Escape(key, false)
+		}
+	} else {
+		rawURL = "https://" + bucket + ".s3." + s.region() + ".amazonaws.com/" + s3Escape(key, false)
+	}
+	if len(query) != 0 {
+		rawURL += "?" + s3CanonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign signs the request with AWS Signature Version 4, if there are credentials
+func (s *S3FileSystem) sign(req *http.Request, now time.Time) {
+	accessKeyID, secretAccessKey, sessionToken := s.AccessKeyID, s.SecretAccessKey, s.SessionToken
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if accessKeyID == "" {
+		return
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptySHA256)
+	if sessionToken != "" {
+		req.Header.Set("x-amz-security-token", sessionToken)
+	}
+
+	// Sign the host, the range and any amz headers
+	signed := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			signed[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	query, _ := url.ParseQuery(req.URL.RawQuery)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		s3CanonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	scope := amzDate[:8] + "/" + s.region() + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{amzDate[:8], s.region(), "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func (s *S3FileSystem) region() string {
+	for _, region := range []string{s.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// parseS3Path splits an s3://bucket/key path into its bucket and key
+func parseS3Path(path string) (bucket string, key string, err error) {
+	if schemeOf(path) != "s3" {
+		return "", "", fmt.Errorf("%s is not an s3:// path", path)
+	}
+
+	trimmed := path[len("s3://"):]
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		bucket, key = trimmed[:i], trimmed[i+1:]
+	} else {
+		bucket = trimmed
+	}
+	if bucket == "" {
+		return "", "", fmt.Errorf("%s has no bucket", path)
+	}
+	return bucket, key, nil
+}
+
+// s3Prefix is the prefix of the objects within the directory named by key
+func s3Prefix(key string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key
+	}
+	return key + "/"
+}
+
+// s3Error describes an unsuccessful response, closing its body
+func s3Error(resp *http.Response, op string, path string) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("Failed to %s %s: %s %s", op, path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// s3Escape URI encodes a string as required by AWS Signature Version 4, leaving slashes
+// unless encodeSlash is true
+func s3Escape(str string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(str) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// s3CanonicalQuery encodes the query sorted by key, as required by AWS Signature Version 4
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,223 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileSystem(t *testing.T) {
+	Convey("FileSystem", t, func() {
+		Convey("is looked up by scheme", func() {
+			fileSystem, err := FileSystemFor("data/people.csv")
+			So(err, ShouldBeNil)
+			So(fileSystem, ShouldHaveSameTypeAs, LocalFileSystem{})
+
+			fileSystem, err = FileSystemFor("file:///data/people.csv")
+			So(err, ShouldBeNil)
+			So(fileSystem, ShouldHaveSameTypeAs, LocalFileSystem{})
+
+			fileSystem, err = FileSystemFor("HTTPS://example.com/people.csv")
+			So(err, ShouldBeNil)
+			So(fileSystem, ShouldHaveSameTypeAs, &HTTPFileSystem{})
+
+			fileSystem, err = FileSystemFor("s3://bucket/people.csv")
+			So(err, ShouldBeNil)
+			So(fileSystem, ShouldHaveSameTypeAs, &S3FileSystem{})
+
+			_, err = FileSystemFor("ftp://example.com/people.csv")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("LocalFileSystem", func() {
+			local := LocalFileSystem{}
+
+			Convey("opens file:// URLs", func() {
+				rc, err := local.Open("file://test/fixtures/dirtest/file1.txt")
+				So(err, ShouldBeNil)
+				So(rc, ShouldHaveSameTypeAs, &os.File{})
+				rc.Close()
+			})
+
+			Convey("stats files and directories", func() {
+				info, err := local.Stat("test/fixtures/dirtest")
+				So(err, ShouldBeNil)
+				So(info.IsDir, ShouldBeTrue)
+
+				info, err = local.Stat("test/fixtures/dirtest/file1.txt")
+				So(err, ShouldBeNil)
+				So(info.IsDir, ShouldBeFalse)
+				So(info.Size, ShouldBeGreaterThanOrEqualTo, 0)
+			})
+
+			Convey("lists nested files in order", func() {
+				files, err := local.List("test/fixtures/dirtest")
+				So(err, ShouldBeNil)
+				paths := []string{}
+				for _, file := range files {
+					paths = append(paths, file.Path)
+				}
+				So(paths, ShouldResemble, []string{
+					"test/fixtures/dirtest/file1.txt",
+					"test/fixtures/dirtest/file2.txt",
+					"test/fixtures/dirtest/nested/nested-file.txt",
+				})
+			})
+		})
+
+		Convey("HTTPFileSystem", func() {
+			modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/people.csv" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+				w.Write([]byte("name\nBob\n"))
+			}))
+			Reset(server.Close)
+			remote := &HTTPFileSystem{}
+
+			Convey("opens URLs", func() {
+				rc, err := remote.Open(server.URL + "/people.csv")
+				So(err, ShouldBeNil)
+				content, _ := ioutil.ReadAll(rc)
+				rc.Close()
+				So(string(content), ShouldEqual, "name\nBob\n")
+
+				_, err = remote.Open(server.URL + "/missing.csv")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("stats URLs", func() {
+				info, err := remote.Stat(server.URL + "/people.csv")
+				So(err, ShouldBeNil)
+				So(info.Size, ShouldEqual, 9)
+				So(info.ModTime.Equal(modTime), ShouldBeTrue)
+			})
+
+			Convey("can't list", func() {
+				_, err := remote.List(server.URL)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("is opened by the Opener when HEAD isn't supported", func() {
+				headStatus := http.StatusMethodNotAllowed
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == "HEAD" {
+						w.WriteHeader(headStatus)
+						return
+					}
+					w.Write([]byte("name\nBob\n"))
+				}))
+				Reset(server.Close)
+
+				open := func() (string, error) {
+					out := make(chan interface{})
+					errChan := NewPipeline().Then(NewOpener(server.URL + "/people.csv")).StreamTo(out).Build().RunAsync()
+					content := ""
+					for rec := range out {
+						file := rec.(*File)
+						read, _ := ioutil.ReadAll(file)
+						file.Close()
+						content += string(read)
+					}
+					return content, <-errChan
+				}
+
+				content, err := open()
+				So(err, ShouldBeNil)
+				So(content, ShouldEqual, "name\nBob\n")
+
+				Convey("but fails for other errors", func() {
+					headStatus = http.StatusForbidden
+					content, err := open()
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "403")
+					So(content, ShouldEqual, "")
+				})
+			})
+		})
+
+		Convey("MemFileSystem", func() {
+			mem := NewMemFileSystem()
+			mem.WriteFileAt("mem://drop/b.csv", []byte("b"), time.Unix(100, 0))
+			mem.WriteFileAt("mem://drop/a.csv", []byte("a"), time.Unix(300, 0))
+			mem.WriteFileAt("mem://drop/nested/c.txt", []byte("c"), time.Unix(200, 0))
+			mem.WriteFileAt("mem://dropped.csv", []byte("x"), time.Unix(200, 0))
+			RegisterFileSystem("mem", mem)
+
+			collect := func(opener *Opener) ([]string, error) {
+				out := make(chan interface{})
+				errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
+				contents := []string{}
+				for rec := range out {
+					file := rec.(*File)
+					content, _ := ioutil.ReadAll(file)
+					file.Close()
+					contents = append(contents, file.Path+"="+string(content))
+				}
+				return contents, <-errChan
+			}
+
+			Convey("stats files and implied directories", func() {
+				info, err := mem.Stat("mem://drop/a.csv")
+				So(err, ShouldBeNil)
+				So(info.Size, ShouldEqual, 1)
+
+				info, err = mem.Stat("mem://drop")
+				So(err, ShouldBeNil)
+				So(info.IsDir, ShouldBeTrue)
+
+				_, err = mem.Stat("mem://missing")
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("can be opened by the Opener", func() {
+				contents, err := collect(NewOpener("mem://drop/a.csv"))
+				So(err, ShouldBeNil)
+				So(contents, ShouldResemble, []string{"mem://drop/a.csv=a"})
+			})
+
+			Convey("lists prefixes through the Opener", func() {
+				contents, err := collect(NewOpener("mem://drop"))
+				So(err, ShouldBeNil)
+				So(contents, ShouldResemble, []string{"mem://drop/a.csv=a", "mem://drop/b.csv=b", "mem://drop/nested/c.txt=c"})
+			})
+
+			Convey("selects from prefixes through the Opener", func() {
+				opener := NewOpener("mem://drop", OpenOpts{Order: OrderByModTime})
+				opener.SetSelection(`\.csv$`)
+				contents, err := collect(opener)
+				So(err, ShouldBeNil)
+				So(contents, ShouldResemble, []string{"mem://drop/b.csv=b", "mem://drop/a.csv=a"})
+			})
+
+			Convey("downloads listed files to TempDir", func() {
+				opener := NewOpener("mem://drop", OpenOpts{TempDir: "test/tmp-mem"})
+				Reset(func() { os.RemoveAll("test/tmp-mem") })
+
+				out := make(chan interface{})
+				errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
+				names := []string{}
+				for rec := range out {
+					file := rec.(*File)
+					So(file.ReadCloser, ShouldHaveSameTypeAs, &os.File{})
+					content, _ := ioutil.ReadAll(file)
+					file.Close()
+					names = append(names, file.Name+"="+string(content))
+				}
+				So(<-errChan, ShouldBeNil)
+				So(names, ShouldResemble, []string{"a.csv=a", "b.csv=b", "c.txt=c"})
+
+				left, err := ioutil.ReadDir("test/tmp-mem")
+				So(err, ShouldBeNil)
+				So(left, ShouldBeEmpty)
+			})
+		})
+	})
+}
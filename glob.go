@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// globMeta are the characters which make a path a glob pattern
+const globMeta = "*?["
+
+// splitGlob splits a path such as data/**/2024-*.csv into the directory to walk (data) and
+// the pattern its files must match (**/2024-*.csv). The pattern is empty if the path has no
+// glob characters. URLs are never treated as patterns, since they may contain a query
+func splitGlob(filePath string) (root string, pattern string) {
+	if strings.Contains(filePath, "://") || !strings.ContainsAny(filePath, globMeta) {
+		return filePath, ""
+	}
+
+	parts := strings.Split(filepath.ToSlash(filePath), "/")
+	for i, part := range parts {
+		if !strings.ContainsAny(part, globMeta) {
+			continue
+		}
+
+		root = strings.Join(parts[:i], "/")
+		if root == "" {
+			root = "."
+			if i > 0 {
+				root = "/"
+			}
+		}
+		return filepath.FromSlash(root), strings.Join(parts[i:], "/")
+	}
+	return filePath, ""
+}
+
+// validateGlob checks that each part of the pattern is well formed
+func validateGlob(pattern string) error {
+	for _, part := range strings.Split(pattern, "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchGlob checks whether the slash separated name matches the pattern. Each part of the
+// pattern matches a single part of the name as in path.Match, except for ** which matches
+// any number of directories
+func matchGlob(pattern string, name string) bool {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// globCanDescend checks whether files within the slash separated directory could match the
+// pattern, so that directories which can't contain any matches are skipped
+func globCanDescend(pattern string, dir string) bool {
+	patternParts := strings.Split(pattern, "/")
+	dirParts := strings.Split(dir, "/")
+	for i, part := range dirParts {
+		if i < len(patternParts) && patternParts[i] == "**" {
+			return true
+		}
+		if i >= len(patternParts)-1 {
+			return false
+		}
+		if matched, _ := path.Match(patternParts[i], part); !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	Convey("Glob", t, func() {
+		Convey("splitGlob splits the directory from the pattern", func() {
+			root, pattern := splitGlob("data/**/2024-*.csv")
+			So(root, ShouldEqual, "data")
+			So(pattern, ShouldEqual, "**/2024-*.csv")
+
+			root, pattern = splitGlob("*.csv")
+			So(root, ShouldEqual, ".")
+			So(pattern, ShouldEqual, "*.csv")
+
+			root, pattern = splitGlob("/srv/data/*/people.csv")
+			So(root, ShouldEqual, "/srv/data")
+			So(pattern, ShouldEqual, "*/people.csv")
+		})
+
+		Convey("splitGlob ignores plain paths and URLs", func() {
+			root, pattern := splitGlob("data/people.csv")
+			So(root, ShouldEqual, "data/people.csv")
+			So(pattern, ShouldEqual, "")
+
+			root, pattern = splitGlob("http://example.com/people.csv?page=*")
+			So(root, ShouldEqual, "http://example.com/people.csv?page=*")
+			So(pattern, ShouldEqual, "")
+		})
+
+		Convey("matchGlob", func() {
+			So(matchGlob("*.csv", "people.csv"), ShouldBeTrue)
+			So(matchGlob("*.csv", "2024/people.csv"), ShouldBeFalse)
+			So(matchGlob("**/2024-*.csv", "2024-01.csv"), ShouldBeTrue)
+			So(matchGlob("**/2024-*.csv", "a/b/2024-01.csv"), ShouldBeTrue)
+			So(matchGlob("**/2024-*.csv", "a/b/2023-01.csv"), ShouldBeFalse)
+			So(matchGlob("a/**", "a/b/c.txt"), ShouldBeTrue)
+			So(matchGlob("a/*/c.txt", "a/b/c.txt"), ShouldBeTrue)
+			So(matchGlob("a/*/c.txt", "a/b/d/c.txt"), ShouldBeFalse)
+		})
+
+		Convey("globCanDescend skips directories that can't match", func() {
+			So(globCanDescend("*.csv", "a"), ShouldBeFalse)
+			So(globCanDescend("a/*/c.txt", "a"), ShouldBeTrue)
+			So(globCanDescend("a/*/c.txt", "a/b"), ShouldBeTrue)
+			So(globCanDescend("a/*/c.txt", "a/b/d"), ShouldBeFalse)
+			So(globCanDescend("a/*/c.txt", "b"), ShouldBeFalse)
+			So(globCanDescend("**/*.csv", "a/b/c"), ShouldBeTrue)
+			So(globCanDescend("a/**", "a/b"), ShouldBeTrue)
+		})
+
+		Convey("validateGlob rejects malformed patterns", func() {
+			So(validateGlob("**/[a-.csv"), ShouldNotBeNil)
+			So(validateGlob("**/2024-*.csv"), ShouldBeNil)
+		})
+	})
+}
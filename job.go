@@ -1,14 +1,20 @@
 package ingest
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/urbint/ingest/utils"
 )
 
 // AbortTimeout is the duration after which aborting will be assumed as timed out. It will be logged as a warning
 var AbortTimeout = time.Second * 10
 
+// ErrAborted is passed to OnFail runners when the Job was aborted
+var ErrAborted = errors.New("job was aborted")
+
 // A Job is a control structure for interacting with a Pipeline
 type Job struct {
 	pipeline *Pipeline
@@ -16,9 +22,13 @@ type Job struct {
 	runnerCount int
 	running     []*runState
 
-	err error
-	mu  sync.Mutex
-	wg  sync.WaitGroup
+	err     error
+	aborted bool
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+
+	progressFn   ProgressFn
+	progressOpts ProgressOpts
 }
 
 // NewJob builds a job with the specified pipeline
@@ -39,6 +49,25 @@ type runState struct {
 	AbortChan chan chan error
 }
 
+// OnProgress calls fn with the Progress reported by the stages of the Job (ie. the Opener, Unzip,
+// CSV and JSON) while it runs. It must be called before the Job is started.
+//
+// fn is called from its own goroutine, at most once per opts.Interval for each file of each stage,
+// so reporting progress never blocks the pipeline. The last Progress of each file is delivered
+// before the Job finishes
+//
+// It returns itself for a chainable API
+func (j *Job) OnProgress(fn ProgressFn, opts ...ProgressOpts) *Job {
+	opt := defaultProgressOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	j.progressFn = fn
+	j.progressOpts = opt
+	return j
+}
+
 // Run runs the Job and blocks until it has completed
 //
 // It returns any error that occured anywhere in the pipeline
@@ -68,6 +97,7 @@ func (j *Job) Start() *Job {
 	defer j.mu.Unlock()
 
 	j.wg = sync.WaitGroup{}
+	j.aborted = false
 
 	stages := sync.WaitGroup{}
 	stages.Add(j.runnerCount)
@@ -82,6 +112,11 @@ func (j *Job) Start() *Job {
 	var in chan interface{}
 	var out chan interface{}
 
+	var progress *progressReporter
+	if j.progressFn != nil {
+		progress = newProgressReporter(j.progressFn, j.progressOpts.Interval)
+	}
+
 	for i := range configs {
 		isLast := i == len(configs)-1
 
@@ -106,9 +141,11 @@ func (j *Job) Start() *Job {
 			}()
 
 			err := config.Runner.Run(&Stage{
-				Abort: abort,
-				In:    in,
-				Out:   out,
+				Abort:    abort,
+				In:       in,
+				Out:      out,
+				progress: progress,
+				runner:   config.Runner.Name(),
 			})
 
 			if err != nil {
@@ -124,11 +161,19 @@ func (j *Job) Start() *Job {
 		stages.Wait()
 		defer j.wg.Done()
 		for _, config := range configs {
+			if asFail, hasFail := config.Runner.(OnFail); hasFail {
+				if err := j.failure(); err != nil {
+					asFail.OnPipelineFailed(err)
+				}
+			}
 			if asDone, hasDone := config.Runner.(OnDone); hasDone {
 				err := asDone.OnPipelineDone()
 				j.handleError(err)
 			}
 		}
+		if progress != nil {
+			progress.close()
+		}
 	}()
 
 	return j
@@ -151,6 +196,10 @@ func (j *Job) Wait() error {
 //
 // It returns a channel of errors encountered while aborting
 func (j *Job) Abort() <-chan error {
+	j.mu.Lock()
+	j.aborted = true
+	j.mu.Unlock()
+
 	result := make(chan error, j.runnerCount)
 	wg := sync.WaitGroup{}
 	wg.Add(j.runnerCount)
@@ -191,6 +240,16 @@ func (j *Job) Abort() <-chan error {
 	return result
 }
 
+// failure returns the error the Job failed with, or ErrAborted if it was aborted
+func (j *Job) failure() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err == nil && j.aborted {
+		return ErrAborted
+	}
+	return j.err
+}
+
 // handleError handles an error if it exists.
 // It will store the error so it can be returned via j.Error()
 // If an error is already stored, the new error will be discarded
@@ -43,6 +43,29 @@ func TestJob(t *testing.T) {
 			})
 		})
 
+		Convey("OnFail", func() {
+			Convey("Tells runners the pipeline failed before they are done", func() {
+				recorder := &failRecorder{}
+				err := NewPipeline().Then(NewMockProcessor(MockOpt{Err: errors.New("Mock Error")})).Then(recorder).Build().Run()
+
+				So(err, ShouldHaveMessage, "Mock Error")
+				So(recorder.calls, ShouldResemble, []string{"failed: Mock Error", "done"})
+			})
+			Convey("Tells runners the pipeline was aborted", func() {
+				recorder := &failRecorder{}
+				job := NewPipeline().Then(NewMockProcessor(MockOpt{Wait: time.Minute})).Then(recorder).Build().Start()
+				<-job.Abort()
+
+				So(job.Wait(), ShouldBeNil)
+				So(recorder.calls, ShouldResemble, []string{"failed: job was aborted", "done"})
+			})
+			Convey("Isn't called when the pipeline succeeds", func() {
+				recorder := &failRecorder{}
+				So(NewPipeline().Then(NewMockProcessor()).Then(recorder).Build().Run(), ShouldBeNil)
+				So(recorder.calls, ShouldResemble, []string{"done"})
+			})
+		})
+
 		Convey("Abort", func() {
 
 			Convey("Emits error channels to all running workers", func() {
@@ -70,3 +93,27 @@ func TestJob(t *testing.T) {
 		})
 	})
 }
+
+// failRecorder records the OnFail and OnDone hooks called on it
+type failRecorder struct {
+	calls []string
+}
+
+func (f *failRecorder) Name() string {
+	return "Fail Recorder"
+}
+
+func (f *failRecorder) Run(stage *Stage) error {
+	for range stage.In {
+	}
+	return nil
+}
+
+func (f *failRecorder) OnPipelineFailed(err error) {
+	f.calls = append(f.calls, "failed: "+err.Error())
+}
+
+func (f *failRecorder) OnPipelineDone() error {
+	f.calls = append(f.calls, "done")
+	return nil
+}
@@ -1,12 +1,19 @@
 package ingest
 
 import (
+	"errors"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/alexflint/go-cloudfile"
 	"github.com/urbint/ingest/utils"
 )
 
@@ -14,32 +21,135 @@ import (
 // each time before checking whether to abort again
 const writeFileBlockSize = 1024
 
+// errAborted stops walking a directory once the stage is aborted
+var errAborted = errors.New("aborted")
+
+// OpenOrder is the order in which the files within a directory are emitted
+type OpenOrder int
+
+const (
+	// OrderByName emits files in the lexical order of their paths
+	OrderByName OpenOrder = iota
+
+	// OrderByModTime emits the least recently modified files first. Files modified at the
+	// same time are emitted in the lexical order of their paths
+	OrderByModTime
+)
+
 // An Opener is a Runner that opens files
 type Opener struct {
 	Opts   OpenOpts
 	logger Logger
 	path   string
 	filter []*regexp.Regexp
+
+	// versions are the versions of the remote files read to the end, by path
+	versions   map[string]Version
+	versionsMu sync.Mutex
+
+	// read are the versions of the remote files read to the end by the current job, which are added
+	// to versions once it succeeds. Files that are verified are unverified until they pass. Once the
+	// job has succeeded, files streamed out of the pipeline are added as they are read
+	read       map[string]Version
+	unverified map[string]Version
+	failed     bool
+	succeeded  bool
+
+	// checksumLists are the SHA256SUMS and MD5SUMS files already read, by path
+	checksumLists   map[string]map[string]string
+	checksumListsMu sync.Mutex
+
+	// bandwidth limits how quickly remote files are read, if Opts.BytesPerSecond is set
+	bandwidth *bandwidthLimiter
+
+	// workspace is the directory within Opts.TempDir that the current job downloads to
+	workspace   string
+	workspaceMu sync.Mutex
+
+	// running is closed once the current job is done, which stops listening for it to be aborted
+	running   chan struct{}
+	runningMu sync.Mutex
 }
 
 // OpenOpts is used to configure how a file is opened
 type OpenOpts struct {
-	// If TempDir is specified, remote files will be downloaded to a temporary directory in full before
-	// being being emitted to the next stage
+	// If TempDir is specified, remote files will be downloaded in full before being emitted to the next
+	// stage. Each job downloads to its own directory made within TempDir, which is removed once the job
+	// is done, whether it succeeded, failed or was aborted
 	TempDir string
 
+	// KeepTemps keeps the files downloaded to TempDir once the job is done, for debugging. The
+	// directory they are kept in is logged
+	KeepTemps bool
+
 	// Logger is the logger that the Opener will log to
 	Logger Logger
 
 	// StreamProgressTo is used to specify a channel which will receive a count of bytes for files that are being downloaded
 	// Currently only works if TempDir is specified. Opening will NOT be blocked by this channel blocking
+	//
+	// Deprecated: Use Job.OnProgress, which describes the file and its size
 	StreamProgressTo chan int64
+
+	// Order is the order in which the files within a directory are emitted. Defaults to OrderByName
+	Order OpenOrder
+
+	// Retries is how many times a transient failure opening or reading a remote file is retried.
+	// Interrupted reads are resumed where they left off if the FileSystem supports it (ie. HTTP
+	// range requests). Defaults to 3, and -1 disables retries
+	Retries int
+
+	// RetryBackoff is how long to wait before the first retry, which doubles with each retry
+	// after it. Defaults to 1 second
+	RetryBackoff time.Duration
+
+	// StateFile is where the versions (ETag and Last-Modified) of remote files which were read to
+	// the end are remembered across runs. When set, remote files that haven't changed since are skipped.
+	// The versions are only saved once the job succeeds, and only for files that passed verification.
+	// Files streamed out of the pipeline and read after the job is done are saved as they are read
+	StateFile string
+
+	// ExpectSHA256 is the hex encoded SHA256 that the opened file must have, and ExpectSize is its size
+	// in bytes. They are checked against every file emitted, so are meant for opening a single file
+	ExpectSHA256 string
+	ExpectSize   int64
+
+	// VerifySidecars checks each file against the checksum published alongside it, either in a
+	// file.csv.sha256 file or in a SHA256SUMS or MD5SUMS file in the same directory. Files without
+	// a checksum are emitted unverified, and the checksum files themselves aren't emitted
+	VerifySidecars bool
+
+	// Concurrency is how many of the files listed under a remote prefix are downloaded to TempDir at
+	// once. It has no effect unless TempDir is set. Defaults to 1
+	Concurrency int
+
+	// KeepOrder emits files downloaded concurrently in the order set by Order. Otherwise each file is
+	// emitted as soon as it has been downloaded
+	KeepOrder bool
+
+	// BytesPerSecond is the most bytes per second read from remote files, shared between all of the
+	// files being downloaded at once. Defaults to unlimited
+	BytesPerSecond int64
+}
+
+// openState is the contents of OpenOpts.StateFile
+type openState struct {
+	Files map[string]Version `json:"files"`
+}
+
+// walkedFile is a file found while walking a directory, which hasn't been opened yet
+type walkedFile struct {
+	path    string
+	modTime time.Time
 }
 
 // defaultOpenOpts sets sane defaults for OpenOpts
 func defaultOpenOpts() OpenOpts {
 	return OpenOpts{
-		Logger: DefaultLogger,
+		Logger:       DefaultLogger,
+		Retries:      3,
+		RetryBackoff: time.Second,
+		Concurrency:  1,
 	}
 }
 
@@ -60,8 +170,25 @@ func NewOpener(path string, opts ...OpenOpts) *Opener {
 // Open is a shortcut to create a new Pipeline that starts with the
 // specified path or file.
 //
-// If the path is a directory, files can be selected from the directory using ingest.Select
+// The path is opened with the FileSystem registered for its URL scheme, so it may be a local
+// path, a file://, http(s):// or s3:// URL, or use any scheme added with RegisterFileSystem.
+//
+// If the path is a directory (or a prefix of remote files), files can be selected from the directory using ingest.Select
 // If the path is a file, the file will be emitted to the next Processor
+// If the path is a glob pattern (ie. data/**/2024-*.csv), the local files matching it will be
+// emitted. ** matches any number of directories
+//
+// The files within a directory are emitted in the order set by OpenOpts.Order, and each is
+// only opened once the next Processor is ready for it
+//
+// Files are emitted as an *ingest.File
+//
+// Files are verified if OpenOpts.ExpectSHA256, ExpectSize or VerifySidecars are set, and their SHA256
+// is recorded on the File. Files on disk (including those downloaded to TempDir) are verified before
+// they are emitted, failing the Opener if they don't match. Streamed files are verified as they are
+// read, so reading them to the end fails instead
+//
+// The bytes read from remote files, and the files emitted, are reported to Job.OnProgress
 func Open(path string, opts ...OpenOpts) *Pipeline {
 	return NewPipeline().Then(NewOpener(path, opts...))
 }
@@ -76,57 +203,276 @@ func (o *Opener) Run(stage *Stage) error {
 	if stage.Out == nil {
 		return nil // Nothing to do here
 	}
+	stage = o.broadcastAbort(stage)
 
 	log := o.logger.WithField("file", o.path)
 
+	if root, pattern := splitGlob(o.path); pattern != "" {
+		if err := validateGlob(pattern); err != nil {
+			return err
+		}
+		log.Info("Opening files matching pattern")
+		return o.emitDirectory(root, pattern, stage)
+	}
+
+	fileSystem, err := FileSystemFor(o.path)
+	if err != nil {
+		return err
+	}
+	if err := o.loadVersions(); err != nil {
+		return err
+	}
+	o.resetVersions()
+	if o.Opts.BytesPerSecond > 0 {
+		o.bandwidth = newBandwidthLimiter(o.Opts.BytesPerSecond)
+	}
+
+	if _, isLocal := fileSystem.(LocalFileSystem); isLocal {
+		return o.emitLocal(fileSystem, stage)
+	}
+
+	// Remote paths which are a prefix of other files are listed like a directory. A path that
+	// can't be described is still opened, leaving Open to report whether it exists
+	info, err := fileSystem.Stat(o.path)
+	if err != nil && !isStatUnsupported(err) {
+		return err
+	} else if err != nil {
+		info = FileInfo{Path: o.path, Size: -1}
+	} else if info.IsDir {
+		log.Info("Opening files with prefix")
+		return o.emitListing(fileSystem, stage)
+	}
+
 	log.Info("Opening file")
-	file, err := cloudfile.Open(o.path)
+	rc, info, err := o.openRemote(fileSystem, info, stage.Abort)
+	if err == ErrNotModified {
+		log.Info("Skipping unchanged file")
+		return nil
+	} else if err == errAborted {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := o.emitRemote(fileSystem, rc, info, stage); err != errAborted {
+		return err
+	}
+	return nil
+}
+
+// emitLocal emits the local file, or walks the directory, at the path
+func (o *Opener) emitLocal(fileSystem FileSystem, stage *Stage) error {
+	o.logger.WithField("file", o.path).Info("Opening file")
+	opened, err := fileSystem.Open(o.path)
 	if err != nil {
 		return err
 	}
 
-	if osFile, isOSFile := file.(*os.File); isOSFile {
-		stat, err := osFile.Stat()
-		if err != nil {
-			return err
+	osFile := opened.(*os.File)
+	stat, err := osFile.Stat()
+	if err != nil {
+		osFile.Close()
+		return err
+	}
+	if stat.IsDir() {
+		osFile.Close()
+		return o.emitDirectory(localPath(o.path), "", stage)
+	}
+
+	file := fileFromOS(osFile, stat)
+	if err := o.verifyLocal(file, osFile); err != nil {
+		osFile.Close()
+		return err
+	}
+
+	select {
+	case <-stage.Abort:
+		osFile.Close()
+	case stage.Out <- file:
+		reportEmitted(stage, file)
+	}
+	return nil
+}
+
+// emitListing emits the files listed under the path by the FileSystem which match the
+// selection, in the order set by Opts.Order. Each file is only opened once it is its turn
+// to be emitted
+func (o *Opener) emitListing(fileSystem FileSystem, stage *Stage) error {
+	files, err := fileSystem.List(o.path)
+	if err != nil {
+		return err
+	}
+	if o.Opts.Order == OrderByModTime {
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].ModTime.Before(files[j].ModTime)
+		})
+	}
+
+	selected := files[:0]
+	for _, info := range files {
+		if o.fileMatchesSelection(info.Path) && !(o.Opts.VerifySidecars && isSidecar(info.Path)) {
+			selected = append(selected, info)
 		}
-		if stat.IsDir() {
-			return o.emitDirectoryTo(osFile, stage.Out)
+	}
+	if o.Opts.TempDir != "" && o.Opts.Concurrency > 1 {
+		return o.emitConcurrently(fileSystem, selected, stage)
+	}
+
+	for _, info := range selected {
+		select {
+		case <-stage.Abort:
+			return nil
+		default:
 		}
-		stage.Out <- osFile
-	} else {
-		if o.Opts.TempDir == "" {
-			stage.Out <- file
-		} else {
-			file, err := o.writeBufferToTemp(file, stage.Abort)
-			if file != nil {
-				log.Info("Finished downloading file")
-				stage.Out <- file
-			}
-			if err != nil {
-				return err
-			}
+
+		rc, info, err := o.openRemote(fileSystem, info, stage.Abort)
+		if err == ErrNotModified {
+			o.logger.WithField("file", info.Path).Info("Skipping unchanged file")
+			continue
+		} else if err == errAborted {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := o.emitRemote(fileSystem, rc, info, stage); err == errAborted {
+			return nil
+		} else if err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
 
-// writeBufferToTemp will take a io.Reader and write it to a temp file based off of the opener.path
-//
-// If abort sends a result, it will stop
-func (o *Opener) writeBufferToTemp(reader io.Reader, abort <-chan chan error) (*os.File, error) {
-	_, outName := filepath.Split(o.path)
-	err := os.MkdirAll(o.Opts.TempDir, 0770)
+// openRemote opens a file from a FileSystem other than the local disk, retrying transient failures.
+// Reads from a ConditionalFileSystem are resumed if they are interrupted, and if Opts.StateFile is
+// set it returns ErrNotModified for files that haven't changed since they were last read to the end.
+// Waiting to retry stops with errAborted once abort receives
+func (o *Opener) openRemote(fileSystem FileSystem, info FileInfo, abort <-chan chan error) (io.ReadCloser, FileInfo, error) {
+	retry := retryPolicy{retries: o.Opts.Retries, backoff: o.Opts.RetryBackoff, abort: abort}
+	log := o.logger.WithField("file", info.Path)
+
+	conditional, isConditional := fileSystem.(ConditionalFileSystem)
+	if !isConditional {
+		var rc io.ReadCloser
+		err := retry.do(log, func() (err error) {
+			rc, err = fileSystem.Open(info.Path)
+			return err
+		})
+		return rc, info, err
+	}
+
+	o.versionsMu.Lock()
+	since := o.versions[info.Path]
+	o.versionsMu.Unlock()
+
+	reader, resp, err := openResuming(conditional, info.Path, since, retry, log)
 	if err != nil {
-		return nil, err
+		return nil, info, err
+	}
+	if resp.Size >= 0 {
+		info.Size = resp.Size
+	}
+	if o.Opts.StateFile != "" {
+		reader.onComplete = func(version Version) { o.readVersion(info.Path, version) }
+	}
+	return reader, info, nil
+}
+
+// emitRemote emits a file opened from a FileSystem other than the local disk, downloading it
+// to TempDir first if it is set. It returns errAborted if the stage is aborted first
+func (o *Opener) emitRemote(fileSystem FileSystem, rc io.ReadCloser, info FileInfo, stage *Stage) error {
+	progress := stage.TrackProgress(info.Path, info.Size)
+	file, err := o.prepareRemote(fileSystem, progress.ReadCloser(rc), info, stage.Abort)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-stage.Abort:
+		file.Close()
+		return errAborted
+	case stage.Out <- file:
+		progress.AddRecords(1)
+		return nil
+	}
+}
+
+// prepareRemote builds the File for a file opened from a FileSystem other than the local disk,
+// downloading it to TempDir first if it is set. It returns errAborted if abort receives first
+func (o *Opener) prepareRemote(fileSystem FileSystem, rc io.ReadCloser, info FileInfo, abort <-chan chan error) (*File, error) {
+	if o.bandwidth != nil {
+		rc = &throttledReader{ReadCloser: rc, limiter: o.bandwidth}
+	}
+
+	var (
+		file      *File
+		verifying *verifyingReader
+	)
+	if o.verifies() {
+		expect, err := o.expectedChecksum(fileSystem, info.Path)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		verifying = newVerifyingReader(rc, info.Path, expect, nil)
+		rc = verifying
+	}
+
+	if o.Opts.TempDir == "" {
+		file = NewFile(rc, info.Path)
+		file.Size = info.Size
+		file.ModTime = info.ModTime
+		if verifying != nil {
+			verifying.onVerified = func(sha256 string) {
+				file.SHA256 = sha256
+				o.versionVerified(info.Path)
+			}
+		}
+	} else {
+		var sha256 string
+		if verifying != nil {
+			verifying.onVerified = func(digest string) {
+				sha256 = digest
+				o.versionVerified(info.Path)
+			}
+		}
+
+		downloaded, err := o.writeBufferToTemp(rc, info.Path, abort)
+		if err != nil {
+			return nil, err
+		} else if downloaded == nil {
+			return nil, errAborted
+		}
+
+		o.logger.WithField("file", info.Path).Info("Finished downloading file")
+		stat, err := downloaded.Stat()
+		if err != nil {
+			downloaded.Close()
+			return nil, err
+		}
+		file = fileFromOS(downloaded, stat)
+		file.Name = path.Base(info.Path)
+		file.SHA256 = sha256
 	}
+	file.SourceURL = info.Path
+	return file, nil
+}
 
+// writeBufferToTemp will take a io.Reader and write it to a temp file named after the remote path,
+// returning the file ready to be read from the start
+//
+// If abort sends a result, it will stop and return a nil file
+func (o *Opener) writeBufferToTemp(reader io.Reader, remotePath string, abort <-chan chan error) (*os.File, error) {
 	if asCloser, canClose := reader.(io.Closer); canClose {
 		defer asCloser.Close()
 	}
 
-	outFile, err := os.Create(filepath.Join(o.Opts.TempDir, outName))
+	dir, err := o.ensureWorkspace()
+	if err != nil {
+		return nil, err
+	}
+
+	// Files listed under a prefix may share a name, so each is given a unique one
+	outFile, err := ioutil.TempFile(dir, "*-"+path.Base(remotePath))
 	if err != nil {
 		return nil, err
 	}
@@ -137,11 +483,16 @@ func (o *Opener) writeBufferToTemp(reader io.Reader, abort <-chan chan error) (*
 			outFile.Close()
 			return nil, nil
 		default:
-			if byteCount, err := io.CopyN(outFile, reader, writeFileBlockSize); err != nil {
-				if o.Opts.StreamProgressTo != nil {
-					go func() { o.Opts.StreamProgressTo <- byteCount }()
-				}
+			byteCount, err := io.CopyN(outFile, reader, writeFileBlockSize)
+			if o.Opts.StreamProgressTo != nil && byteCount > 0 {
+				go func() { o.Opts.StreamProgressTo <- byteCount }()
+			}
+			if err != nil {
 				if err == io.EOF {
+					if _, err := outFile.Seek(0, io.SeekStart); err != nil {
+						outFile.Close()
+						return nil, err
+					}
 					return outFile, nil
 				}
 				outFile.Close()
@@ -158,15 +509,159 @@ func (o *Opener) SetSelection(selection ...string) {
 	}
 }
 
+// loadVersions reads the versions of the remote files already read from Opts.StateFile
+func (o *Opener) loadVersions() error {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+
+	if o.Opts.StateFile == "" || o.versions != nil {
+		return nil
+	}
+
+	state := openState{}
+	if err := readStateFile(o.Opts.StateFile, &state); err != nil {
+		return err
+	}
+	o.versions = state.Files
+	if o.versions == nil {
+		o.versions = map[string]Version{}
+	}
+	return nil
+}
+
+// readVersion records the version of a remote file which was read to the end by the current job.
+// If files are verified it is held back until the file passes
+func (o *Opener) readVersion(filePath string, version Version) {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+
+	if o.verifies() {
+		if o.unverified == nil {
+			o.unverified = map[string]Version{}
+		}
+		o.unverified[filePath] = version
+		return
+	}
+	o.addVersion(filePath, version)
+}
+
+// versionVerified records the version of a remote file read to the end once it passes verification
+func (o *Opener) versionVerified(filePath string) {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+
+	version, isRead := o.unverified[filePath]
+	if !isRead {
+		return
+	}
+	delete(o.unverified, filePath)
+	o.addVersion(filePath, version)
+}
+
+// addVersion adds the version of a file read by the current job, saving it straight away if the
+// job has already succeeded. It must be called with versionsMu held
+func (o *Opener) addVersion(filePath string, version Version) {
+	if !o.succeeded {
+		if o.read == nil {
+			o.read = map[string]Version{}
+		}
+		o.read[filePath] = version
+		return
+	}
+
+	o.versions[filePath] = version
+	if err := writeStateFile(o.Opts.StateFile, openState{Files: o.versions}); err != nil {
+		o.logger.WithError(err).WithField("file", filePath).Warn("Failed to save the version of the file")
+	}
+}
+
+// resetVersions forgets the versions read by the previous job
+func (o *Opener) resetVersions() {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+	o.read, o.unverified, o.failed, o.succeeded = nil, nil, false, false
+}
+
+// saveVersions remembers the versions of the remote files read by the current job in
+// Opts.StateFile, unless it failed. Files are often read after the Opener has finished, so this
+// waits until the job is done
+func (o *Opener) saveVersions() error {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+
+	read := o.read
+	o.read = nil
+	if o.failed || o.Opts.StateFile == "" {
+		o.unverified = nil
+		return nil
+	}
+	o.succeeded = true
+	if len(read) == 0 {
+		return nil
+	}
+
+	for filePath, version := range read {
+		o.versions[filePath] = version
+	}
+	return writeStateFile(o.Opts.StateFile, openState{Files: o.versions})
+}
+
+// ensureWorkspace creates the directory within Opts.TempDir for the current job if needed
+func (o *Opener) ensureWorkspace() (string, error) {
+	o.workspaceMu.Lock()
+	defer o.workspaceMu.Unlock()
+
+	if o.workspace == "" {
+		if err := os.MkdirAll(o.Opts.TempDir, 0770); err != nil {
+			return "", err
+		}
+		dir, err := os.MkdirTemp(o.Opts.TempDir, "ingest-")
+		if err != nil {
+			return "", err
+		}
+		o.workspace = dir
+	}
+	return o.workspace, nil
+}
+
+// OnPipelineFailed implements ingest.OnFail for Opener, so that the versions of the files read
+// aren't saved to Opts.StateFile
+func (o *Opener) OnPipelineFailed(err error) {
+	o.versionsMu.Lock()
+	defer o.versionsMu.Unlock()
+	o.failed = true
+}
+
 // OnPipelineDone implements ingest.OnDone for Opener
+//
+// It saves the versions of the remote files read to Opts.StateFile if the job succeeded, and
+// removes the directory the job downloaded to, unless Opts.KeepTemps is set
 func (o *Opener) OnPipelineDone() error {
-	if o.Opts.TempDir != "" {
-		if err := os.RemoveAll(o.Opts.TempDir); err != nil {
-			return err
-		}
+	o.runningMu.Lock()
+	if o.running != nil {
+		close(o.running)
+		o.running = nil
 	}
+	o.runningMu.Unlock()
 
-	return nil
+	if err := o.saveVersions(); err != nil {
+		o.logger.WithError(err).Warn("Failed to save the versions of the files read")
+	}
+
+	o.workspaceMu.Lock()
+	defer o.workspaceMu.Unlock()
+
+	if o.workspace == "" {
+		return nil
+	}
+	dir := o.workspace
+	o.workspace = ""
+
+	if o.Opts.KeepTemps {
+		o.logger.WithField("dir", dir).Info("Keeping temporary files")
+		return nil
+	}
+	return os.RemoveAll(dir)
 }
 
 // SkipAbortErr saves us having to send nil errors back on abort
@@ -174,44 +669,217 @@ func (o *Opener) SkipAbortErr() bool {
 	return true
 }
 
-// emitDirectoryTo will recursively traverse a directory and emit all files (matching the filter, if any)
-// to the specified channel.
-func (o *Opener) emitDirectoryTo(dir *os.File, out chan interface{}) error {
-	files, err := dir.Readdir(0)
+// broadcastAbort returns a copy of the stage whose Abort is closed once the stage is aborted, so
+// that the files being read by later stages see it as well as the Opener. It keeps listening until
+// the job is done, as streamed files are still read after Run has returned
+func (o *Opener) broadcastAbort(stage *Stage) *Stage {
+	aborted := make(chan chan error)
+	running := make(chan struct{})
+	o.runningMu.Lock()
+	o.running = running
+	o.runningMu.Unlock()
+
+	go func() {
+		select {
+		case <-stage.Abort:
+			close(aborted)
+		case <-running:
+		}
+	}()
+
+	broadcast := *stage
+	broadcast.Abort = aborted
+	return &broadcast
+}
+
+// emitDirectory walks the directory, emitting the files matching the pattern (if any) and the
+// selection in the order set by Opts.Order. Files are opened one at a time as they are emitted,
+// and the walk stops if the stage is aborted
+func (o *Opener) emitDirectory(root string, pattern string, stage *Stage) error {
+	var pending []walkedFile
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-stage.Abort:
+			return errAborted
+		default:
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if pattern != "" && rel != "." && !globCanDescend(pattern, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (pattern != "" && !matchGlob(pattern, rel)) || !o.fileMatchesSelection(filePath) {
+			return nil
+		}
+		if o.Opts.VerifySidecars && isSidecar(filePath) {
+			return nil
+		}
+
+		// WalkDir visits files in lexical order, so they can be emitted as they are found
+		if o.Opts.Order != OrderByModTime {
+			return emitFile(filePath, stage, o.verifyLocal)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		pending = append(pending, walkedFile{path: filePath, modTime: info.ModTime()})
+		return nil
+	})
+	if err == errAborted {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].modTime.Before(pending[j].modTime)
+	})
+	for _, walked := range pending {
+		if err := emitFile(walked.path, stage, o.verifyLocal); err == errAborted {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitFile opens the file and emits it, closing it again if the stage is aborted first. If prepare
+// isn't nil the file is only emitted once it succeeds, so it can verify or wrap the file
+func emitFile(filePath string, stage *Stage, prepare func(file *File, osFile *os.File) error) error {
+	osFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	stat, err := osFile.Stat()
 	if err != nil {
+		osFile.Close()
 		return err
 	}
 
-	for _, fileInfo := range files {
-		fullPath := filepath.Join(dir.Name(), fileInfo.Name())
-		file, err := os.Open(fullPath)
-		if err != nil {
+	file := fileFromOS(osFile, stat)
+	if prepare != nil {
+		if err := prepare(file, osFile); err != nil {
+			osFile.Close()
 			return err
 		}
+	}
 
-		if fileInfo.IsDir() {
-			if err := o.emitDirectoryTo(file, out); err != nil {
-				return err
-			}
-		} else {
-			if o.fileMatchesSelection(file) {
-				out <- file
+	select {
+	case <-stage.Abort:
+		osFile.Close()
+		return errAborted
+	case stage.Out <- file:
+		reportEmitted(stage, file)
+		return nil
+	}
+}
+
+// reportEmitted reports the progress of a file emitted from disk, which is already complete
+func reportEmitted(stage *Stage, file *File) {
+	stage.ReportProgress(Progress{File: file.Path, BytesDone: file.Size, BytesTotal: file.Size, RecordsEmitted: 1})
+}
+
+// verifies checks whether the files opened are verified
+func (o *Opener) verifies() bool {
+	return o.Opts.ExpectSHA256 != "" || o.Opts.ExpectSize > 0 || o.Opts.VerifySidecars
+}
+
+// verifyLocal checksums a local file against the checksum expected of it, if files are verified
+func (o *Opener) verifyLocal(file *File, osFile *os.File) error {
+	if !o.verifies() {
+		return nil
+	}
+	expect, err := o.expectedChecksum(LocalFileSystem{}, file.Path)
+	if err != nil {
+		return err
+	}
+	return verifyOnDisk(file, osFile, file.Path, expect)
+}
+
+// expectedChecksum returns the checksum expected of the file at filePath, from Opts.ExpectSHA256 and
+// Opts.ExpectSize, or else from its sidecar if Opts.VerifySidecars is set
+func (o *Opener) expectedChecksum(fileSystem FileSystem, filePath string) (checksum, error) {
+	expect := checksum{sha256: strings.ToLower(o.Opts.ExpectSHA256), size: -1}
+	if o.Opts.ExpectSize > 0 {
+		expect.size = o.Opts.ExpectSize
+	}
+	if !o.Opts.VerifySidecars || expect.sha256 != "" {
+		return expect, nil
+	}
+
+	lines, found, err := readSidecar(fileSystem, filePath+".sha256")
+	if err != nil {
+		return expect, err
+	}
+	if found && len(lines) != 0 {
+		expect.sha256 = strings.ToLower(strings.Fields(lines[0])[0])
+		return expect, nil
+	}
+
+	dir, name := splitDir(filePath)
+	for _, list := range sidecarLists {
+		digests, err := o.checksumList(fileSystem, dir+list.name)
+		if err != nil {
+			return expect, err
+		}
+		if digest, isListed := digests[name]; isListed {
+			if list.kind == "MD5" {
+				expect.md5 = digest
+			} else {
+				expect.sha256 = digest
 			}
+			return expect, nil
 		}
 	}
-	return nil
+	return expect, nil
+}
+
+// checksumList reads the digests in a SHA256SUMS or MD5SUMS file, which are remembered for the
+// other files in the same directory. A missing list has no digests
+func (o *Opener) checksumList(fileSystem FileSystem, listPath string) (map[string]string, error) {
+	o.checksumListsMu.Lock()
+	defer o.checksumListsMu.Unlock()
+
+	if digests, isRead := o.checksumLists[listPath]; isRead {
+		return digests, nil
+	}
+
+	lines, _, err := readSidecar(fileSystem, listPath)
+	if err != nil {
+		return nil, err
+	}
+	if o.checksumLists == nil {
+		o.checksumLists = map[string]map[string]string{}
+	}
+	o.checksumLists[listPath] = parseChecksumList(lines)
+	return o.checksumLists[listPath], nil
 }
 
-// fileMatchesSelection checks whether the files name matches any of the applied filters.
+// fileMatchesSelection checks whether the path of a file matches any of the applied filters.
 //
 // If no filters are specified it will return true
-func (o *Opener) fileMatchesSelection(file *os.File) bool {
+func (o *Opener) fileMatchesSelection(filePath string) bool {
 	if len(o.filter) == 0 {
 		return true
 	}
 
 	for _, f := range o.filter {
-		if f.MatchString(file.Name()) {
+		if f.MatchString(filePath) {
 			return true
 		}
 	}
@@ -6,7 +6,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestOpener(t *testing.T) {
@@ -19,7 +21,8 @@ func TestOpener(t *testing.T) {
 				err := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
 				results := []interface{}{}
 				for file := range out {
-					asFile := file.(*os.File)
+					asFile := file.(*File)
+					So(asFile.ReadCloser, ShouldHaveSameTypeAs, &os.File{})
 					asFile.Close()
 					results = append(results, file)
 				}
@@ -34,7 +37,8 @@ func TestOpener(t *testing.T) {
 				err := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
 				results := []interface{}{}
 				for file := range out {
-					asFile := file.(*os.File)
+					asFile := file.(*File)
+					So(asFile.ReadCloser, ShouldHaveSameTypeAs, &os.File{})
 					asFile.Close()
 					results = append(results, file)
 				}
@@ -43,9 +47,80 @@ func TestOpener(t *testing.T) {
 			})
 		})
 
+		Convey("With a glob pattern", func() {
+			dir, err := ioutil.TempDir("", "ingest-glob-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+
+			now := time.Now()
+			for i, name := range []string{"b/2024-02.csv", "a/2024-03.csv", "2024-01.csv", "a/2023-12.csv", "b/c/2024-04.csv", "a/2024-notes.txt"} {
+				filePath := filepath.Join(dir, filepath.FromSlash(name))
+				So(os.MkdirAll(filepath.Dir(filePath), 0770), ShouldBeNil)
+				So(ioutil.WriteFile(filePath, []byte(name), 0660), ShouldBeNil)
+				modTime := now.Add(-time.Duration(i) * time.Hour)
+				So(os.Chtimes(filePath, modTime, modTime), ShouldBeNil)
+			}
+
+			collect := func(opener *Opener) ([]string, error) {
+				out := make(chan interface{})
+				errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
+				names := []string{}
+				for file := range out {
+					rel, _ := filepath.Rel(dir, file.(*File).Path)
+					names = append(names, filepath.ToSlash(rel))
+					file.(*File).Close()
+				}
+				return names, <-errChan
+			}
+
+			Convey("emits the matching files in lexical order", func() {
+				names, err := collect(NewOpener(filepath.Join(dir, "**", "2024-*.csv")))
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"2024-01.csv", "a/2024-03.csv", "b/2024-02.csv", "b/c/2024-04.csv"})
+			})
+
+			Convey("matches single directories with *", func() {
+				names, err := collect(NewOpener(filepath.Join(dir, "*", "*.csv")))
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"a/2023-12.csv", "a/2024-03.csv", "b/2024-02.csv"})
+			})
+
+			Convey("can order by modification time", func() {
+				names, err := collect(NewOpener(filepath.Join(dir, "**", "2024-*.csv"), OpenOpts{Order: OrderByModTime}))
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"b/c/2024-04.csv", "2024-01.csv", "a/2024-03.csv", "b/2024-02.csv"})
+			})
+
+			Convey("can be filtered via select", func() {
+				opener := NewOpener(filepath.Join(dir, "**", "*.csv"))
+				opener.SetSelection("2023")
+				names, err := collect(opener)
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"a/2023-12.csv"})
+			})
+
+			Convey("fails for malformed patterns", func() {
+				_, err := collect(NewOpener(filepath.Join(dir, "[a-")))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("stops walking when aborted", func() {
+				abort := make(chan chan error)
+				stage := &Stage{In: make(chan interface{}), Out: make(chan interface{}), Abort: abort}
+				done := make(chan error)
+				go func() { done <- NewOpener(filepath.Join(dir, "**", "*.csv")).Run(stage) }()
+
+				file := (<-stage.Out).(*File)
+				file.Close()
+				abort <- make(chan error, 1)
+				So(<-done, ShouldBeNil)
+			})
+		})
+
 		Convey("with HTTP", func() {
 			httpmock.Activate()
 			httpmock.RegisterResponder("GET", "http://google.com", httpmock.NewStringResponder(200, `Hello world`))
+			httpmock.RegisterResponder("HEAD", "http://google.com", httpmock.NewStringResponder(200, `Hello world`))
 
 			Reset(func() {
 				httpmock.DeactivateAndReset()
@@ -68,11 +143,13 @@ func TestOpener(t *testing.T) {
 				opener := NewOpener("http://google.com", OpenOpts{TempDir: "test/tmp"})
 				errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
 
-				Convey("emits an os.File", func() {
+				Convey("emits a File reading the downloaded os.File", func() {
 					rec := <-out
 
 					So(<-errChan, ShouldBeNil)
-					So(rec, ShouldHaveSameTypeAs, &os.File{})
+					So(rec, ShouldHaveSameTypeAs, &File{})
+					So(rec.(*File).ReadCloser, ShouldHaveSameTypeAs, &os.File{})
+					So(rec.(*File).SourceURL, ShouldEqual, "http://google.com")
 				})
 
 				Convey("with StreamProgressTo set", func() {
@@ -89,12 +166,36 @@ func TestOpener(t *testing.T) {
 					So(bytes, ShouldBeGreaterThan, 0)
 				})
 
-				Convey("removes TempDir on OnPipelineDone", func() {
-					err := opener.OnPipelineDone()
-					So(err, ShouldBeNil)
+				Convey("downloads to its own directory, which is removed once the job is done", func() {
+					Reset(func() { os.RemoveAll("test/tmp") })
+					file := (<-out).(*File)
+					file.Close()
+					So(<-errChan, ShouldBeNil)
 
-					_, err = os.Stat("test/tmp")
+					dir := filepath.Dir(file.Path)
+					So(filepath.Dir(dir), ShouldEqual, filepath.Join("test", "tmp"))
+					_, err := os.Stat(dir)
 					So(os.IsNotExist(err), ShouldBeTrue)
+
+					_, err = os.Stat("test/tmp")
+					So(err, ShouldBeNil)
+				})
+
+				Convey("keeps the directory with KeepTemps", func() {
+					Reset(func() { os.RemoveAll("test/tmp") })
+					<-out
+					<-errChan
+
+					out := make(chan interface{})
+					opener := NewOpener("http://google.com", OpenOpts{TempDir: "test/tmp", KeepTemps: true})
+					errChan := NewPipeline().Then(opener).StreamTo(out).Build().RunAsync()
+					file := (<-out).(*File)
+					file.Close()
+					So(<-errChan, ShouldBeNil)
+
+					content, err := ioutil.ReadFile(file.Path)
+					So(err, ShouldBeNil)
+					So(string(content), ShouldEqual, "Hello world")
 				})
 			})
 		})
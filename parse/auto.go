@@ -0,0 +1,315 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// sniffSize is the number of bytes peeked from an input when detecting its format
+const sniffSize = 512
+
+// The formats that can be detected by Auto, to be used as the keys of its mappers
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatXML   = "xml"
+)
+
+type (
+	// An AutoProcessor detects the format of each input and parses it with the matching parser
+	AutoProcessor struct {
+		mappers map[string]interface{}
+		logger  ingest.Logger
+		opts    *AutoOpts
+	}
+
+	// AutoOpts are options used to configure an AutoProcessor
+	AutoOpts struct {
+		// AbortOnUnknownFormat will cause the parser to stop if it receives an input it has no
+		// mapper for. Otherwise the input is skipped
+		AbortOnUnknownFormat bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// A Record is emitted by the AutoProcessor for every parsed record
+	Record struct {
+		// Source is the name of the input the record was parsed from, if known
+		Source string
+
+		// File describes the input the record was parsed from, if known
+		File *ingest.File
+
+		// Format is the detected format of the input, ie. parse.FormatCSV
+		Format string
+
+		// Value is the parsed record
+		Value interface{}
+	}
+
+	// sniffedReader is an input whose leading bytes have been read to detect its format
+	sniffedReader struct {
+		io.Reader
+		closers []io.Closer
+
+		// isArray is true if the input is a JSON array, whose elements are the records
+		isArray bool
+	}
+)
+
+// Auto returns a *parse.AutoProcessor which detects the format of each input by its extension
+// and leading bytes, and parses it using the mapper specified for that format.
+//
+// mappers is keyed by format (parse.FormatCSV, parse.FormatJSON, parse.FormatJSONL and
+// parse.FormatXML). JSON Lines inputs use the JSON mapper if no JSONL mapper is specified.
+// Gzipped inputs are decompressed before their contents are detected.
+// Every record is emitted as a parse.Record
+func Auto(mappers map[string]interface{}, opts ...AutoOpts) *AutoProcessor {
+	opt := defaultAutoOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	processor := &AutoProcessor{
+		mappers: mappers,
+		opts:    &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultAutoOpts() AutoOpts {
+	return AutoOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for AutoProcessor
+func (a *AutoProcessor) Name() string {
+	return "Auto"
+}
+
+// Run implements ingest.Runner for AutoProcessor
+func (a *AutoProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			source := ingest.PathOf(input)
+			file := ingest.FileOf(input)
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+
+			reader, format, err := sniffFormat(rc, source)
+			if err != nil {
+				rc.Close()
+				return err
+			}
+
+			log := a.logger.WithField("file", source).WithField("format", format)
+
+			parser := a.parserFor(format, reader.isArray)
+			if parser == nil {
+				reader.Close()
+				if a.opts.AbortOnUnknownFormat {
+					return fmt.Errorf("Auto has no mapper for %s (detected format %q)", source, format)
+				}
+				log.Warn("Skipping input with no mapper for its format")
+				continue
+			}
+
+			// The parser is given the metadata of the input along with the sniffed reader
+			var parsed interface{} = reader
+			if file != nil {
+				sniffed := *file
+				sniffed.ReadCloser = reader
+				parsed = &sniffed
+			}
+
+			log.Debug("Parsing input")
+			if aborted, err := a.runParser(stage, parser, parsed, Record{Source: source, Format: format, File: file}); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (a *AutoProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// parserFor builds a new parser for the format, or returns nil if there is no mapper for it
+func (a *AutoProcessor) parserFor(format string, isArray bool) ingest.Runner {
+	mapper := a.mappers[format]
+	if mapper == nil && format == FormatJSONL {
+		mapper = a.mappers[FormatJSON]
+	}
+	if mapper == nil {
+		return nil
+	}
+
+	switch format {
+	case FormatCSV:
+		return CSV(mapper, CSVOpts{Logger: a.opts.Logger})
+	case FormatJSON, FormatJSONL:
+		opts := JSONOpts{Logger: a.opts.Logger}
+		if isArray {
+			opts.Selector = "*"
+		}
+		return JSON(mapper, opts)
+	case FormatXML:
+		return XML(mapper, XMLOpts{Logger: a.opts.Logger})
+	}
+	return nil
+}
+
+// runParser runs the parser over a single input, emitting its records as copies of tmpl
+//
+// It returns true if the stage was aborted
+func (a *AutoProcessor) runParser(stage *ingest.Stage, parser ingest.Runner, input interface{}, tmpl Record) (bool, error) {
+	abort := make(chan chan error)
+	sub := &ingest.Stage{
+		In:    make(chan interface{}, 1),
+		Out:   make(chan interface{}),
+		Abort: abort,
+	}
+	sub.In <- input
+	close(sub.In)
+
+	done := make(chan error, 1)
+	finished := make(chan bool)
+	go func() {
+		done <- parser.Run(sub)
+		close(sub.Out)
+		close(finished)
+	}()
+
+	// abortParser stops the parser and waits for it to finish, closing the input if
+	// the parser never received it
+	abortParser := func() {
+		go func() {
+			for range sub.Out {
+			}
+		}()
+		select {
+		case abort <- make(chan error, 1):
+		case <-finished:
+		}
+		<-finished
+		for unread := range sub.In {
+			unread.(io.Closer).Close()
+		}
+	}
+
+	for {
+		select {
+		case <-stage.Abort:
+			abortParser()
+			return true, nil
+		case rec, ok := <-sub.Out:
+			if !ok {
+				return false, <-done
+			}
+
+			out := tmpl
+			out.Value = rec
+
+			select {
+			case <-stage.Abort:
+				abortParser()
+				return true, nil
+			case stage.Out <- out:
+			}
+		}
+	}
+}
+
+// sniffFormat detects the format of rc by the extension of name and its leading bytes,
+// decompressing it if it is gzipped. The returned reader must be used instead of rc
+func sniffFormat(rc io.ReadCloser, name string) (*sniffedReader, string, error) {
+	reader := &sniffedReader{closers: []io.Closer{rc}}
+
+	buffered := bufio.NewReaderSize(rc, sniffSize)
+	head, _ := buffered.Peek(sniffSize)
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".gz" || bytes.HasPrefix(head, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", err
+		}
+		inner, format, err := sniffFormat(gz, strings.TrimSuffix(name, filepath.Ext(name)))
+		if err != nil {
+			return nil, "", err
+		}
+		inner.closers = append(inner.closers, rc)
+		return inner, format, nil
+	}
+
+	reader.Reader = buffered
+
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	reader.isArray = len(trimmed) > 0 && trimmed[0] == '['
+
+	switch ext {
+	case ".csv":
+		return reader, FormatCSV, nil
+	case ".json":
+		return reader, FormatJSON, nil
+	case ".jsonl", ".ndjson":
+		return reader, FormatJSONL, nil
+	case ".xml":
+		return reader, FormatXML, nil
+	}
+
+	switch {
+	case len(trimmed) == 0:
+		return reader, "", nil
+	case trimmed[0] == '<':
+		return reader, FormatXML, nil
+	case trimmed[0] == '[':
+		return reader, FormatJSON, nil
+	case trimmed[0] == '{':
+		// Objects on multiple lines are JSON Lines, unless the first object spans several lines
+		if newline := bytes.IndexByte(trimmed, '\n'); newline != -1 && bytes.HasSuffix(bytes.TrimSpace(trimmed[:newline]), []byte("}")) {
+			return reader, FormatJSONL, nil
+		}
+		return reader, FormatJSON, nil
+	case ext == "" && bytes.IndexByte(head, 0) == -1:
+		// Only assume text is CSV if there is no extension saying otherwise, ie. a README.txt
+		return reader, FormatCSV, nil
+	}
+
+	return reader, "", nil
+}
+
+// Close closes the input along with any decompressors wrapping it
+func (s *sniffedReader) Close() error {
+	var result error
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
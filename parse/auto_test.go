@@ -0,0 +1,79 @@
+package parse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestAuto(t *testing.T) {
+	type Person struct {
+		Name string `csv:"name" json:"name" xml:"name"`
+		Age  int    `csv:"age" json:"age" xml:"age"`
+	}
+
+	Convey("Auto", t, func() {
+		mappers := map[string]interface{}{
+			FormatCSV:  Person{},
+			FormatJSON: Person{},
+			FormatXML:  Person{},
+		}
+
+		Convey("parses a directory of mixed formats", func() {
+			out := make(chan interface{})
+			errChan := ingest.Open("../test/fixtures/autotest").Then(Auto(mappers)).StreamTo(out).Build().RunAsync()
+
+			formats := map[string][]string{}
+			for rec := range out {
+				record := rec.(Record)
+				source := filepath.Base(record.Source)
+				formats[source] = append(formats[source], record.Format)
+				So(record.Value, ShouldHaveSameTypeAs, Person{})
+			}
+
+			So(<-errChan, ShouldBeNil)
+			So(formats, ShouldResemble, map[string][]string{
+				"people.csv":    {FormatCSV, FormatCSV},
+				"people.json":   {FormatJSON, FormatJSON},
+				"more.jsonl.gz": {FormatJSONL, FormatJSONL},
+				"people.xml":    {FormatXML},
+			})
+		})
+
+		Convey("fails on unknown formats if configured to", func() {
+			out := make(chan interface{})
+			parser := Auto(map[string]interface{}{FormatCSV: Person{}}, AutoOpts{AbortOnUnknownFormat: true})
+			errChan := ingest.Open("../test/fixtures/autotest/people.xml").Then(parser).StreamTo(out).Build().RunAsync()
+
+			for range out {
+			}
+			So(<-errChan, ShouldNotBeNil)
+		})
+	})
+
+	Convey("sniffFormat", t, func() {
+		sniff := func(content string, name string) string {
+			_, format, err := sniffFormat(ioutil.NopCloser(bytes.NewBufferString(content)), name)
+			So(err, ShouldBeNil)
+			return format
+		}
+
+		Convey("detects formats by content", func() {
+			So(sniff("\n  <?xml version=\"1.0\"?><a/>", ""), ShouldEqual, FormatXML)
+			So(sniff(`[{"a": 1}]`, ""), ShouldEqual, FormatJSON)
+			So(sniff("{\"a\": 1}\n{\"a\": 2}\n", ""), ShouldEqual, FormatJSONL)
+			So(sniff("{\n  \"a\": 1\n}", ""), ShouldEqual, FormatJSON)
+			So(sniff("a,b\n1,2\n", ""), ShouldEqual, FormatCSV)
+		})
+
+		Convey("prefers the extension", func() {
+			So(sniff(`{"a": 1}`, "data/file.jsonl"), ShouldEqual, FormatJSONL)
+			So(sniff("a,b", "file.txt"), ShouldEqual, "")
+		})
+	})
+}
@@ -114,7 +114,7 @@ func (c *CSVProcessor) Run(stage *ingest.Stage) error {
 			if err != nil {
 				return err
 			}
-			c.handleIO(stage, asRC)
+			c.handleIO(stage, asRC, ingest.FileOf(input))
 		}
 	}
 }
@@ -128,7 +128,7 @@ func (c *CSVProcessor) ParseHeader(headers []string) {
 	result := map[int][]int{}
 	for column := 0; column < len(headers); column++ {
 		header := strings.TrimSpace(headers[column])
-		findResult, _ := findFieldInStruct(header, targetType)
+		findResult, _ := findFieldInStruct(header, "csv", targetType)
 		result[column] = findResult
 	}
 
@@ -160,58 +160,8 @@ func (c *CSVProcessor) ParseRow(row []string) (interface{}, error) {
 			field = field.Field(fieldIndex)
 		}
 
-		fieldInterface := field.Interface()
-		switch fieldInterface.(type) {
-		case string:
-			if c.opts.TrimSpaces {
-				field.SetString(strings.TrimSpace(row[j]))
-			} else {
-				field.SetString(row[j])
-			}
-		case float32:
-			val, err := strconv.ParseFloat(row[j], 32)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing float: %v", row[j])
-			}
-			field.SetFloat(val)
-		case int:
-			val, err := strconv.Atoi(row[j])
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing int: %v", row[j])
-			}
-			field.SetInt(int64(val))
-		case int8:
-			val, err := strconv.ParseInt(row[j], 10, 8)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing int: %v", row[j])
-			}
-			field.SetInt(val)
-		case uint8:
-			val, err := strconv.ParseUint(row[j], 10, 8)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing uint: %v", row[j])
-			}
-			field.SetUint(val)
-		case uint16:
-			val, err := strconv.ParseUint(row[j], 10, 16)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing uint: %v", row[j])
-			}
-			field.SetUint(val)
-		case uint32:
-			val, err := strconv.ParseUint(row[j], 10, 32)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing uint: %v", row[j])
-			}
-			field.SetUint(val)
-		case time.Time:
-			time, err := time.Parse(c.opts.DateFormat, row[j])
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing date: %v", row[j])
-			}
-			field.Set(reflect.ValueOf(time))
-		default:
-			return nil, fmt.Errorf("Unhandled type: %v", field.Type().String())
+		if err := setField(field, row[j], c.opts.TrimSpaces, c.opts.DateFormat); err != nil {
+			return nil, err
 		}
 	}
 
@@ -229,8 +179,9 @@ func (c *CSVProcessor) SkipAbortErr() bool {
 }
 
 // handleIOReader handles an io.Reader input
-func (c *CSVProcessor) handleIO(stage *ingest.Stage, input io.ReadCloser) error {
-	reader := csv.NewReader(input)
+func (c *CSVProcessor) handleIO(stage *ingest.Stage, input io.ReadCloser, file *ingest.File) error {
+	progress := trackProgress(stage, file)
+	reader := csv.NewReader(progress.Reader(input))
 	defer input.Close()
 
 	if !c.opts.SkipHeader {
@@ -258,7 +209,8 @@ func (c *CSVProcessor) handleIO(stage *ingest.Stage, input io.ReadCloser) error
 				select {
 				case <-stage.Abort:
 					return nil
-				case stage.Out <- rec:
+				case stage.Out <- withSourceFile(rec, file):
+					progress.AddRecords(1)
 				}
 			} else {
 				return nil
@@ -326,7 +278,80 @@ func (c *CSVProcessor) startDecoders(input chan []string, errChan chan error) (o
 	return output
 }
 
-func findFieldInStruct(fieldName string, target reflect.Type) (result []int, found bool) {
+// setField converts value to the type of field and sets it. It is shared by the
+// parsers that decode text values into mapper structs
+func setField(field reflect.Value, value string, trimSpaces bool, dateFormat string) error {
+	fieldInterface := field.Interface()
+	switch fieldInterface.(type) {
+	case string:
+		if trimSpaces {
+			field.SetString(strings.TrimSpace(value))
+		} else {
+			field.SetString(value)
+		}
+	case float32:
+		val, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return fmt.Errorf("Error parsing float: %v", value)
+		}
+		field.SetFloat(val)
+	case float64:
+		val, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing float: %v", value)
+		}
+		field.SetFloat(val)
+	case int:
+		val, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Error parsing int: %v", value)
+		}
+		field.SetInt(int64(val))
+	case int8:
+		val, err := strconv.ParseInt(value, 10, 8)
+		if err != nil {
+			return fmt.Errorf("Error parsing int: %v", value)
+		}
+		field.SetInt(val)
+	case int64:
+		val, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing int: %v", value)
+		}
+		field.SetInt(val)
+	case uint8:
+		val, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fmt.Errorf("Error parsing uint: %v", value)
+		}
+		field.SetUint(val)
+	case uint16:
+		val, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("Error parsing uint: %v", value)
+		}
+		field.SetUint(val)
+	case uint32:
+		val, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("Error parsing uint: %v", value)
+		}
+		field.SetUint(val)
+	case time.Time:
+		time, err := time.Parse(dateFormat, value)
+		if err != nil {
+			return fmt.Errorf("Error parsing date: %v", value)
+		}
+		field.Set(reflect.ValueOf(time))
+	default:
+		return fmt.Errorf("Unhandled type: %v", field.Type().String())
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func findFieldInStruct(fieldName string, tagName string, target reflect.Type) (result []int, found bool) {
 	numFields := target.NumField()
 	for i := 0; i < numFields; i++ {
 		field := target.Field(i)
@@ -334,6 +359,11 @@ func findFieldInStruct(fieldName string, target reflect.Type) (result []int, fou
 
 		isEmbeddedStruct := kind == reflect.Struct || (kind == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct)
 
+		// time.Time is decoded as a value rather than searched as a nested struct
+		if field.Type == timeType {
+			isEmbeddedStruct = false
+		}
+
 		if isEmbeddedStruct {
 			var nestedTarget reflect.Type
 			if kind == reflect.Struct {
@@ -341,14 +371,14 @@ func findFieldInStruct(fieldName string, target reflect.Type) (result []int, fou
 			} else {
 				nestedTarget = field.Type.Elem()
 			}
-			nestedIndexes, found := findFieldInStruct(fieldName, nestedTarget)
+			nestedIndexes, found := findFieldInStruct(fieldName, tagName, nestedTarget)
 			if found {
 				result := append([]int{i}, nestedIndexes...)
 				return result, true
 			}
 		} else {
-			csvName := field.Tag.Get("csv")
-			if csvName == fieldName {
+			tagValue := field.Tag.Get(tagName)
+			if tagValue == fieldName {
 				return []int{i}, true
 			}
 		}
@@ -0,0 +1,131 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// A Feature is a single geographic record, as read from GeoJSON or a Shapefile
+	Feature struct {
+		ID       interface{} `json:"id,omitempty"`
+		Geometry *Geometry   `json:"geometry"`
+
+		// Properties holds the attributes of the feature. It is a map[string]interface{}
+		// unless a properties mapper was specified, in which case it is of the mapper's type
+		Properties interface{} `json:"properties"`
+
+		// Projection is the WKT projection of the geometry, if known (ie. from a .prj file)
+		Projection string `json:"-"`
+	}
+
+	// A Geometry is a GeoJSON geometry object.
+	//
+	// Coordinates are decoded according to Type: a Point is a []float64, LineString and MultiPoint
+	// are [][]float64, Polygon and MultiLineString are [][][]float64 and a MultiPolygon
+	// is a [][][][]float64. A GeometryCollection uses Geometries instead.
+	Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates,omitempty"`
+		Geometries  []*Geometry `json:"geometries,omitempty"`
+	}
+
+	// GeoJSONOpts are options used to configure a GeoJSON processor
+	GeoJSONOpts struct {
+		// Properties is a mapper that the properties of each feature will be decoded to
+		Properties interface{}
+
+		// Selector is the path to the features within the document. Defaults to "features.*"
+		Selector string
+
+		AbortOnFailedObject bool
+		NumDecoders         int
+		Logger              ingest.Logger
+	}
+)
+
+// GeoJSON returns a *parse.JSONProcessor which will stream the features of a GeoJSON
+// FeatureCollection as parse.Feature records
+func GeoJSON(opts ...GeoJSONOpts) *JSONProcessor {
+	opt := GeoJSONOpts{Selector: "features.*"}
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	processor := JSON(Feature{}, JSONOpts{
+		Selector:            opt.Selector,
+		AbortOnFailedObject: opt.AbortOnFailedObject,
+		NumDecoders:         opt.NumDecoders,
+		Logger:              opt.Logger,
+	})
+
+	if opt.Properties == nil {
+		return processor
+	}
+
+	// Pre-populating Properties with a pointer to a new mapper causes encoding/json to
+	// decode into it rather than into a map
+	propertiesType := reflect.Indirect(reflect.ValueOf(opt.Properties)).Type()
+	propertiesPtr := reflect.TypeOf(opt.Properties).Kind() == reflect.Ptr
+
+	processor.newInstance = func() reflect.Value {
+		return reflect.ValueOf(&Feature{Properties: reflect.New(propertiesType).Interface()})
+	}
+	processor.toRecord = func(rec reflect.Value) interface{} {
+		feature := rec.Interface().(*Feature)
+		if !propertiesPtr {
+			if props := reflect.ValueOf(feature.Properties); props.Kind() == reflect.Ptr && !props.IsNil() {
+				feature.Properties = props.Elem().Interface()
+			}
+		}
+		return *feature
+	}
+
+	return processor
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Geometry, decoding the coordinates
+// to the nesting depth of the geometry type
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Geometries  []*Geometry     `json:"geometries"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	g.Type = raw.Type
+	g.Geometries = raw.Geometries
+
+	var coordinates interface{}
+	switch raw.Type {
+	case "Point":
+		coordinates = &[]float64{}
+	case "LineString", "MultiPoint":
+		coordinates = &[][]float64{}
+	case "Polygon", "MultiLineString":
+		coordinates = &[][][]float64{}
+	case "MultiPolygon":
+		coordinates = &[][][][]float64{}
+	case "GeometryCollection":
+		return nil
+	default:
+		return fmt.Errorf("Unknown GeoJSON geometry type: %q", raw.Type)
+	}
+
+	if len(raw.Coordinates) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Coordinates, coordinates); err != nil {
+		return err
+	}
+	g.Coordinates = reflect.ValueOf(coordinates).Elem().Interface()
+
+	return nil
+}
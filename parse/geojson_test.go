@@ -0,0 +1,76 @@
+package parse
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestGeoJSON(t *testing.T) {
+	var SampleGeoJSON = `{
+		"type": "FeatureCollection",
+		"features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-89.4012, 43.0731]}, "properties": {"name": "Madison Substation", "voltage": 138}},
+			{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[-89.4, 43.1], [-89.5, 43.2]]}, "properties": {"name": "Feeder 12", "voltage": 13}}
+		]
+	}`
+
+	type Asset struct {
+		Name    string `json:"name"`
+		Voltage int    `json:"voltage"`
+	}
+
+	run := func(parser *JSONProcessor) (results []Feature, err error) {
+		stage := ingest.NewStage()
+		go func() {
+			stage.In <- bytes.NewBufferString(SampleGeoJSON)
+			close(stage.In)
+		}()
+
+		done := make(chan bool)
+		go func() {
+			err = parser.Run(stage)
+			close(stage.Out)
+			close(done)
+		}()
+
+		for res := range stage.Out {
+			results = append(results, res.(Feature))
+		}
+		<-done
+		return results, err
+	}
+
+	Convey("GeoJSON", t, func() {
+		Convey("streams the features of a collection", func() {
+			results, err := run(GeoJSON())
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+		})
+
+		Convey("decodes coordinates by geometry type", func() {
+			results, _ := run(GeoJSON(GeoJSONOpts{NumDecoders: 1}))
+
+			So(results[0].Geometry, ShouldResemble, &Geometry{Type: "Point", Coordinates: []float64{-89.4012, 43.0731}})
+			So(results[1].Geometry, ShouldResemble, &Geometry{Type: "LineString", Coordinates: [][]float64{{-89.4, 43.1}, {-89.5, 43.2}}})
+		})
+
+		Convey("decodes properties to a map by default", func() {
+			results, _ := run(GeoJSON(GeoJSONOpts{NumDecoders: 1}))
+
+			So(results[0].Properties, ShouldResemble, map[string]interface{}{"name": "Madison Substation", "voltage": float64(138)})
+		})
+
+		Convey("decodes properties to a mapper", func() {
+			results, _ := run(GeoJSON(GeoJSONOpts{NumDecoders: 1, Properties: Asset{}}))
+			So(results[1].Properties, ShouldResemble, Asset{Name: "Feeder 12", Voltage: 13})
+
+			results, _ = run(GeoJSON(GeoJSONOpts{NumDecoders: 1, Properties: &Asset{}}))
+			So(results[1].Properties, ShouldResemble, &Asset{Name: "Feeder 12", Voltage: 13})
+		})
+	})
+}
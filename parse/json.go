@@ -16,6 +16,7 @@ type (
 	JSONProcessor struct {
 		mapper      interface{}
 		newInstance func() reflect.Value
+		toRecord    func(rec reflect.Value) interface{}
 		logger      ingest.Logger
 
 		workerOut      chan interface{}
@@ -46,7 +47,7 @@ func JSON(mapper interface{}, opts ...JSONOpts) *JSONProcessor {
 
 	indirectType := reflect.Indirect(reflect.ValueOf(mapper)).Type()
 
-	return &JSONProcessor{
+	processor := &JSONProcessor{
 		workersWorking: make(chan bool, opt.NumDecoders),
 		workerErr:      make(chan error, opt.NumDecoders),
 		workerOut:      make(chan interface{}, opt.NumDecoders),
@@ -57,6 +58,9 @@ func JSON(mapper interface{}, opts ...JSONOpts) *JSONProcessor {
 		logger:         opt.Logger,
 		opts:           &opt,
 	}
+	processor.toRecord = processor.defaultToRecord
+
+	return processor
 }
 
 func defaultJSONOpts() JSONOpts {
@@ -113,12 +117,20 @@ func (j *JSONProcessor) Run(stage *ingest.Stage) error {
 			if err != nil {
 				return err
 			}
-			go j.handleIO(rc)
+			file := ingest.FileOf(input)
+			progress := trackProgress(stage, file)
+			// Hold the WaitGroup until handleIO has registered its worker so closing
+			// the input can't race with the worker starting
+			j.workerWg.Add(1)
+			go func() {
+				defer j.workerWg.Done()
+				j.handleIO(progress.ReadCloser(rc), file, progress)
+			}()
 		}
 	}
 }
 
-func (j *JSONProcessor) handleIO(rc io.ReadCloser) {
+func (j *JSONProcessor) handleIO(rc io.ReadCloser, file *ingest.File, progress *ingest.ProgressTracker) {
 	j.workersWorking <- true
 	j.workerWg.Add(1)
 	go func() {
@@ -153,24 +165,27 @@ func (j *JSONProcessor) handleIO(rc io.ReadCloser) {
 					continue
 				}
 
-				var toSend interface{}
-
-				if j.sendPtr {
-					toSend = rec.Interface()
-				} else {
-					toSend = rec.Elem().Interface()
-				}
+				toSend := withSourceFile(j.toRecord(rec), file)
 
 				select {
 				case <-j.workerQuit:
 					return
 				case j.workerOut <- toSend:
+					progress.AddRecords(1)
 				}
 			}
 		}
 	}()
 }
 
+// defaultToRecord returns the decoded value as the same kind (pointer or value) as the mapper
+func (j *JSONProcessor) defaultToRecord(rec reflect.Value) interface{} {
+	if j.sendPtr {
+		return rec.Interface()
+	}
+	return rec.Elem().Interface()
+}
+
 func (j *JSONProcessor) navigateToSelection(decoder *json.Decoder) error {
 	nestIn := strings.Split(j.opts.Selector, ".")
 	for len(nestIn) > 0 {
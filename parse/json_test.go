@@ -62,7 +62,7 @@ func TestJSON(t *testing.T) {
 				parser := JSON([]int{}, JSONOpts{Selector: "nested.deeply"})
 
 				rc := ioutil.NopCloser(bytes.NewBufferString(sampleJSON))
-				go parser.handleIO(rc)
+				go parser.handleIO(rc, nil, nil)
 
 				select {
 				case err := <-parser.workerErr:
@@ -77,7 +77,7 @@ func TestJSON(t *testing.T) {
 
 				parser := JSON(result, JSONOpts{Selector: "nested.deeply.*"})
 				rc := ioutil.NopCloser(bytes.NewBufferString(sampleJSON))
-				go parser.handleIO(rc)
+				go parser.handleIO(rc, nil, nil)
 
 				select {
 				case err := <-parser.workerErr:
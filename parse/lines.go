@@ -0,0 +1,305 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// Built-in patterns that can be used as LineOpts.Pattern
+const (
+	// ApacheCombinedPattern matches the Apache / NGINX combined log format. Its groups are host, ident,
+	// user, time, method, path, protocol, status, size, referer and agent. Use ApacheDateFormat to
+	// parse time
+	ApacheCombinedPattern = `^(?P<host>\S+) (?P<ident>\S+) (?P<user>\S+) \[(?P<time>[^\]]+)\] ` +
+		`"(?:(?P<method>\S+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?|-)" ` +
+		`(?P<status>\d{3}) (?:(?P<size>\d+)|-)(?: "(?P<referer>[^"]*)" "(?P<agent>[^"]*)")?$`
+
+	// SyslogPattern matches RFC5424 syslog messages. Its groups are priority, version, timestamp,
+	// hostname, app_name, proc_id, msg_id, structured_data and message. Nil values ("-") are left
+	// empty. Use time.RFC3339Nano to parse timestamp
+	SyslogPattern = `^<(?P<priority>\d{1,3})>(?P<version>\d{1,2}) (?:-|(?P<timestamp>\S+)) ` +
+		`(?:-|(?P<hostname>\S+)) (?:-|(?P<app_name>\S+)) (?:-|(?P<proc_id>\S+)) (?:-|(?P<msg_id>\S+)) ` +
+		`(?:-|(?P<structured_data>(?:\[(?:[^\]\\]|\\.)*\])+))(?: (?P<message>.*))?$`
+
+	// ApacheDateFormat is the format of the time field of ApacheCombinedPattern
+	ApacheDateFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+type (
+	// A LineProcessor is a processor that decodes each line of its input to a struct
+	LineProcessor struct {
+		mapper  interface{}
+		pattern *regexp.Regexp
+		logger  ingest.Logger
+
+		// fieldMap maps the names of fields found on the lines to the indicies of the mapper's field
+		fieldMap map[string][]int
+
+		opts    *LineOpts
+		sendPtr bool
+	}
+
+	// LineOpts are options used to configure a LineProcessor
+	LineOpts struct {
+		// Pattern is a regular expression with named capture groups (ie. `(?P<name>\w+)`). The value
+		// of each group is stored in the mapper field with the same name in its struct tag
+		Pattern string
+
+		// Format is used instead of Pattern to extract the fields from a line, ie. parse.Logfmt
+		Format LineFormat
+
+		// Tag is the struct tag used to map fields. Defaults to "log"
+		Tag string
+
+		// DateFormat is the format of Date strings used by the mapper to parse the dates.
+		// Defaults to time.RFC3339
+		DateFormat string
+
+		// TrimSpaces determines whether spaces will be trimmed on fields
+		TrimSpaces bool
+
+		// MaxLineSize is the longest line, in bytes, that can be read. Defaults to 1MB
+		MaxLineSize int
+
+		// AbortOnFailedRow will cause the parser to stop if a line doesn't match or can't be decoded
+		AbortOnFailedRow bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// A LineFormat extracts the named fields from a single line. It returns false if the
+	// line isn't in the expected format
+	LineFormat func(line string) (fields map[string]string, ok bool)
+)
+
+// Lines returns a *parse.LineProcessor which will decode each line of its inputs to the mapper
+//
+// Either opts.Pattern or opts.Format must be specified. It will panic if the Pattern can't be compiled
+func Lines(mapper interface{}, opts ...LineOpts) *LineProcessor {
+	opt := defaultLineOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	processor := &LineProcessor{
+		mapper:   mapper,
+		sendPtr:  reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		fieldMap: map[string][]int{},
+		opts:     &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	if opt.Format == nil {
+		processor.pattern = regexp.MustCompile(opt.Pattern)
+	}
+
+	return processor
+}
+
+func defaultLineOpts() LineOpts {
+	return LineOpts{
+		Tag:         "log",
+		DateFormat:  time.RFC3339,
+		MaxLineSize: 1 << 20,
+		Logger:      ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for LineProcessor
+func (l *LineProcessor) Name() string {
+	return "Lines"
+}
+
+// Run implements ingest.Runner for LineProcessor
+func (l *LineProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := l.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (l *LineProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// ParseLine parses a single line and returns a new instance of the
+// same type as the mapper.
+func (l *LineProcessor) ParseLine(line string) (interface{}, error) {
+	fields, matched := l.extractFields(line)
+	if !matched {
+		return nil, fmt.Errorf("Line does not match the expected format: %q", line)
+	}
+
+	instance := reflect.New(reflect.Indirect(reflect.ValueOf(l.mapper)).Type())
+	for name, value := range fields {
+		fieldIndicies := l.fieldIndicies(name)
+
+		// Keep the "nil" version of the struct field if there is no value or mapping
+		if len(fieldIndicies) == 0 || len(value) == 0 {
+			continue
+		}
+
+		field := instance.Elem()
+		for _, fieldIndex := range fieldIndicies {
+			field = field.Field(fieldIndex)
+		}
+
+		if err := setField(field, value, l.opts.TrimSpaces, l.opts.DateFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.sendPtr {
+		return instance.Interface(), nil
+	}
+	return instance.Elem().Interface(), nil
+}
+
+// handleIO decodes every line of the input and emits them to stage.Out
+//
+// It returns true if the stage was aborted while emitting
+func (l *LineProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(nil, l.opts.MaxLineSize)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		rec, err := l.ParseLine(line)
+		if err != nil {
+			if l.opts.AbortOnFailedRow {
+				return false, err
+			}
+			l.logger.WithError(err).Warn("Error parsing line")
+			continue
+		}
+
+		select {
+		case <-stage.Abort:
+			return true, nil
+		case stage.Out <- withSourceFile(rec, file):
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// extractFields returns the named fields of the line using the Format or Pattern
+func (l *LineProcessor) extractFields(line string) (map[string]string, bool) {
+	if l.opts.Format != nil {
+		return l.opts.Format(line)
+	}
+
+	match := l.pattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+
+	fields := map[string]string{}
+	for i, name := range l.pattern.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	return fields, true
+}
+
+// fieldIndicies returns the indicies of the mapper field for the named field, caching the lookup
+func (l *LineProcessor) fieldIndicies(name string) []int {
+	if indicies, cached := l.fieldMap[name]; cached {
+		return indicies
+	}
+
+	targetType := reflect.Indirect(reflect.ValueOf(l.mapper)).Type()
+	indicies, _ := findFieldInStruct(name, l.opts.Tag, targetType)
+	l.fieldMap[name] = indicies
+	return indicies
+}
+
+// Logfmt is a LineFormat for logfmt lines such as `level=info msg="started job" id=12`
+//
+// Keys without a value are given the value "true"
+func Logfmt(line string) (map[string]string, bool) {
+	fields := map[string]string{}
+
+	for i := 0; i < len(line); {
+		// Skip whitespace between pairs
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		keyStart := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[keyStart:i]
+		if key == "" {
+			return nil, false
+		}
+
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = "true"
+			continue
+		}
+		i++ // Skip the =
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+
+		valueStart := i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		fields[key] = line[valueStart:i]
+	}
+
+	return fields, len(fields) > 0
+}
@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	type Request struct {
+		Host   string    `log:"host"`
+		Time   time.Time `log:"time"`
+		Method string    `log:"method"`
+		Path   string    `log:"path"`
+		Status int       `log:"status"`
+		Size   int       `log:"size"`
+		Agent  string    `log:"agent"`
+	}
+
+	Convey("Lines", t, func() {
+		Convey("ParseLine", func() {
+			Convey("maps named groups to fields", func() {
+				parser := Lines(Request{}, LineOpts{Pattern: `^(?P<method>\w+) (?P<path>\S+) (?P<status>\d+)$`})
+				res, err := parser.ParseLine("GET /index.html 200")
+
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, Request{Method: "GET", Path: "/index.html", Status: 200})
+			})
+
+			Convey("fails on lines that don't match", func() {
+				parser := Lines(&Request{}, LineOpts{Pattern: `^(?P<method>\w+)$`})
+				_, err := parser.ParseLine("GET /index.html")
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("parses the Apache combined format", func() {
+				parser := Lines(&Request{}, LineOpts{Pattern: ApacheCombinedPattern, DateFormat: ApacheDateFormat})
+				res, err := parser.ParseLine(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`)
+
+				So(err, ShouldBeNil)
+				req := res.(*Request)
+				So(req.Host, ShouldEqual, "127.0.0.1")
+				So(req.Path, ShouldEqual, "/apache_pb.gif")
+				So(req.Size, ShouldEqual, 2326)
+				So(req.Agent, ShouldEqual, "Mozilla/4.08")
+				So(req.Time.Unix(), ShouldEqual, 971211336)
+			})
+
+			Convey("parses RFC5424 syslog", func() {
+				type Message struct {
+					Priority int    `log:"priority"`
+					Hostname string `log:"hostname"`
+					App      string `log:"app_name"`
+					ProcID   string `log:"proc_id"`
+					Message  string `log:"message"`
+				}
+
+				parser := Lines(Message{}, LineOpts{Pattern: SyslogPattern})
+				res, err := parser.ParseLine(`<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 [exampleSDID@32473 iut="3"] 'su root' failed`)
+
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, Message{Priority: 34, Hostname: "mymachine.example.com", App: "su", Message: "'su root' failed"})
+			})
+
+			Convey("parses logfmt", func() {
+				type Entry struct {
+					Level   string `log:"level"`
+					Message string `log:"msg"`
+					ID      int    `log:"id"`
+					Debug   string `log:"debug"`
+				}
+
+				parser := Lines(Entry{}, LineOpts{Format: Logfmt})
+				res, err := parser.ParseLine(`level=info msg="started \"job\"" id=12 debug`)
+
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, Entry{Level: "info", Message: `started "job"`, ID: 12, Debug: "true"})
+			})
+		})
+
+		Convey("Run", func() {
+			stage := ingest.NewStage()
+			parser := Lines(Request{}, LineOpts{Pattern: `^(?P<method>\w+) (?P<path>\S+) (?P<status>\d+)$`})
+
+			go func() {
+				stage.In <- bytes.NewBufferString("GET / 200\r\nnot a request\n\nPOST /login 302\n")
+				close(stage.In)
+			}()
+
+			var err error
+			go func() {
+				err = parser.Run(stage)
+				close(stage.Out)
+			}()
+
+			results := []interface{}{}
+			for res := range stage.Out {
+				results = append(results, res)
+			}
+
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{
+				Request{Method: "GET", Path: "/", Status: 200},
+				Request{Method: "POST", Path: "/login", Status: 302},
+			})
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package parse
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+	"github.com/vmihailenco/msgpack"
+)
+
+type (
+	// A MsgPackProcessor is a processor that reads concatenated MessagePack values
+	MsgPackProcessor struct {
+		mapper      interface{}
+		newInstance func() reflect.Value
+		logger      ingest.Logger
+
+		opts    *MsgPackOpts
+		sendPtr bool
+	}
+
+	// MsgPackOpts are options used to configure a MsgPackProcessor
+	MsgPackOpts struct {
+		// AbortOnFailedObject will cause the parser to stop if a value can't be decoded.
+		//
+		// MessagePack values carry no framing, so a value that fails to decode ends
+		// processing of the input it came from either way
+		AbortOnFailedObject bool
+
+		// UseJSONTag will fall back to json struct tags for fields without a msgpack tag
+		UseJSONTag bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// MsgPack returns a *parse.MsgPackProcessor which will decode MessagePack values to a specified struct
+func MsgPack(mapper interface{}, opts ...MsgPackOpts) *MsgPackProcessor {
+	opt := defaultMsgPackOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	indirectType := reflect.Indirect(reflect.ValueOf(mapper)).Type()
+
+	processor := &MsgPackProcessor{
+		mapper:      mapper,
+		newInstance: func() reflect.Value { return reflect.New(indirectType) },
+		sendPtr:     reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		opts:        &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultMsgPackOpts() MsgPackOpts {
+	return MsgPackOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for MsgPackProcessor
+func (m *MsgPackProcessor) Name() string {
+	return "MsgPack"
+}
+
+// Run implements ingest.Runner for MsgPackProcessor
+func (m *MsgPackProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := m.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (m *MsgPackProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// handleIO decodes all values from the input and emits them to stage.Out
+//
+// It returns true if the stage was aborted while emitting
+func (m *MsgPackProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	decoder := msgpack.NewDecoder(rc).UseJSONTag(m.opts.UseJSONTag)
+
+	for {
+		rec := m.newInstance()
+		if err := decoder.Decode(rec.Interface()); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			if m.opts.AbortOnFailedObject {
+				return false, err
+			}
+			m.logger.WithError(err).Warn("Error decoding MessagePack value, skipping rest of input")
+			return false, nil
+		}
+
+		var toSend interface{}
+		if m.sendPtr {
+			toSend = rec.Interface()
+		} else {
+			toSend = rec.Elem().Interface()
+		}
+
+		select {
+		case <-stage.Abort:
+			return true, nil
+		case stage.Out <- withSourceFile(toSend, file):
+		}
+	}
+}
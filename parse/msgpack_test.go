@@ -0,0 +1,64 @@
+package parse
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/urbint/conveyer"
+	"github.com/urbint/ingest"
+	"github.com/vmihailenco/msgpack"
+
+	"testing"
+)
+
+func TestMsgPack(t *testing.T) {
+	type Person struct {
+		ID   int    `msgpack:"id"`
+		Name string `msgpack:"name"`
+	}
+
+	Convey("MsgPack", t, func() {
+		stage := ingest.NewStage()
+
+		buf := &bytes.Buffer{}
+		encoder := msgpack.NewEncoder(buf)
+		for _, person := range []Person{{1, "Bob"}, {2, "Steve O"}, {3, "James"}} {
+			So(encoder.Encode(person), ShouldBeNil)
+		}
+
+		run := func(parser *MsgPackProcessor) (results []interface{}, err error) {
+			go func() {
+				stage.In <- buf
+				close(stage.In)
+			}()
+
+			done := make(chan bool)
+			go func() {
+				err = parser.Run(stage)
+				close(stage.Out)
+				close(done)
+			}()
+
+			for res := range stage.Out {
+				results = append(results, res)
+			}
+			<-done
+			return results, err
+		}
+
+		Convey("decodes concatenated values", func() {
+			results, err := run(MsgPack(Person{}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 3)
+			So(results, ShouldContainSomethingLike, Person{ID: 3, Name: "James"})
+		})
+
+		Convey("emits pointers when given a pointer mapper", func() {
+			results, err := run(MsgPack(&Person{}))
+
+			So(err, ShouldBeNil)
+			So(results[0], ShouldResemble, &Person{ID: 1, Name: "Bob"})
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package parse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// A ProtoProcessor is a processor that reads length-delimited protobuf messages.
+	//
+	// Each message is expected to be prefixed by its size encoded as a varint, which is
+	// the format written by Java's writeDelimitedTo and Go's pbutil.WriteDelimited
+	ProtoProcessor struct {
+		newMessage func() proto.Message
+		logger     ingest.Logger
+		opts       *ProtoOpts
+	}
+
+	// ProtoOpts are options used to configure a ProtoProcessor
+	ProtoOpts struct {
+		// AbortOnFailedObject will cause the parser to stop if a message can't be unmarshalled
+		AbortOnFailedObject bool
+
+		// MaxMessageSize is the largest message size (in bytes) that will be read. A larger
+		// length prefix is treated as a corrupt stream. Defaults to 64MB
+		MaxMessageSize uint64
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// ProtoDelimited returns a *parse.ProtoProcessor which will decode varint-prefixed protobuf
+// messages. newMessage is called to build a fresh message for every record
+func ProtoDelimited(newMessage func() proto.Message, opts ...ProtoOpts) *ProtoProcessor {
+	opt := defaultProtoOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	processor := &ProtoProcessor{
+		newMessage: newMessage,
+		opts:       &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultProtoOpts() ProtoOpts {
+	return ProtoOpts{
+		MaxMessageSize: 64 << 20,
+		Logger:         ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for ProtoProcessor
+func (p *ProtoProcessor) Name() string {
+	return "Proto"
+}
+
+// Run implements ingest.Runner for ProtoProcessor
+func (p *ProtoProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := p.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (p *ProtoProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// handleIO reads all messages from the input and emits them to stage.Out
+//
+// It returns true if the stage was aborted while emitting
+func (p *ProtoProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	reader := bufio.NewReader(rc)
+	var buf []byte
+
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		if size > p.opts.MaxMessageSize {
+			return false, fmt.Errorf("Protobuf message size %d exceeds MaxMessageSize %d", size, p.opts.MaxMessageSize)
+		}
+
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return false, err
+		}
+
+		msg := p.newMessage()
+		if err := proto.Unmarshal(buf, msg); err != nil {
+			if p.opts.AbortOnFailedObject {
+				return false, err
+			}
+			p.logger.WithError(err).Warn("Error unmarshalling protobuf message")
+			continue
+		}
+
+		select {
+		case <-stage.Abort:
+			return true, nil
+		case stage.Out <- withSourceFile(msg, file):
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestProtoDelimited(t *testing.T) {
+	writeDelimited := func(buf *bytes.Buffer, msg proto.Message) {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			panic(err)
+		}
+		prefix := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(prefix, uint64(len(data)))
+		buf.Write(prefix[:n])
+		buf.Write(data)
+	}
+
+	Convey("ProtoDelimited", t, func() {
+		stage := ingest.NewStage()
+		parser := ProtoDelimited(func() proto.Message { return &wrappers.StringValue{} })
+
+		Convey("emits every message in the stream", func() {
+			buf := &bytes.Buffer{}
+			for _, name := range []string{"Bob", "Steve O", "James"} {
+				writeDelimited(buf, &wrappers.StringValue{Value: name})
+			}
+
+			go func() {
+				stage.In <- buf
+				close(stage.In)
+			}()
+
+			var err error
+			go func() {
+				err = parser.Run(stage)
+				close(stage.Out)
+			}()
+
+			results := []string{}
+			for res := range stage.Out {
+				results = append(results, res.(*wrappers.StringValue).Value)
+			}
+
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []string{"Bob", "Steve O", "James"})
+		})
+
+		Convey("fails on a truncated message", func() {
+			buf := &bytes.Buffer{}
+			writeDelimited(buf, &wrappers.StringValue{Value: "Bob"})
+			buf.Truncate(buf.Len() - 1)
+
+			go func() {
+				stage.In <- buf
+				close(stage.In)
+			}()
+
+			var err error
+			go func() {
+				err = parser.Run(stage)
+				close(stage.Out)
+			}()
+
+			for range stage.Out {
+			}
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,463 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jonas-p/go-shp"
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// A ShapefileProcessor is a processor that reads ESRI Shapefiles into Features
+	//
+	// It receives the files making up each shapefile (.shp, .dbf and optionally .prj) as
+	// named readers, such as those emitted by ingest.Open on a directory or by process.Unzip.
+	// Files that belong to the same shapefile are matched up by name.
+	//
+	// Each part is read as it arrives, so that archive runners which wait for an entry to be read
+	// before emitting the next can carry on. The .dbf and .prj are read into memory, and a .shp that
+	// isn't already a file on disk is copied to a temporary file in ShapefileOpts.TempDir
+	ShapefileProcessor struct {
+		mapper  interface{}
+		logger  ingest.Logger
+		opts    *ShapefileOpts
+		sendPtr bool
+	}
+
+	// ShapefileOpts are options used to configure a ShapefileProcessor
+	ShapefileOpts struct {
+		// DateFormat is the format of Date attributes. Defaults to the DBF format of "20060102"
+		DateFormat string
+
+		// AbortOnFailedRecord will cause the parser to stop if a record can't be decoded
+		AbortOnFailedRecord bool
+
+		// TempDir is where .shp files are copied while the rest of their shapefile arrives.
+		// Defaults to the system's temporary directory
+		TempDir string
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// shapefileSet holds the open parts of a single shapefile
+	shapefileSet struct {
+		name          string
+		shp, dbf, prj io.ReadCloser
+	}
+
+	// tempPart is a part of a shapefile copied to a temporary file, which is removed when it is closed
+	tempPart struct {
+		*os.File
+	}
+)
+
+// Shapefile returns a *parse.ShapefileProcessor which will emit a parse.Feature for every shape.
+//
+// The attributes of each shape are decoded to the mapper using "dbf" struct tags and stored
+// as the Feature's Properties. If mapper is nil, Properties will be a map[string]interface{}
+func Shapefile(mapper interface{}, opts ...ShapefileOpts) *ShapefileProcessor {
+	opt := defaultShapefileOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	processor := &ShapefileProcessor{
+		mapper:  mapper,
+		sendPtr: mapper != nil && reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		opts:    &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultShapefileOpts() ShapefileOpts {
+	return ShapefileOpts{
+		DateFormat: "20060102",
+		Logger:     ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for ShapefileProcessor
+func (s *ShapefileProcessor) Name() string {
+	return "Shapefile"
+}
+
+// Run implements ingest.Runner for ShapefileProcessor
+func (s *ShapefileProcessor) Run(stage *ingest.Stage) error {
+	pending := map[string]*shapefileSet{}
+	defer func() {
+		for _, set := range pending {
+			set.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return s.handleRemaining(stage, pending)
+			}
+
+			name := ingest.PathOf(input)
+			if name == "" {
+				return fmt.Errorf("Shapefile received input without a file name: %T", input)
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+
+			ext := strings.ToLower(filepath.Ext(name))
+			if ext != ".shp" && ext != ".dbf" && ext != ".prj" {
+				s.logger.WithField("file", name).Debug("Skipping non-shapefile file")
+				rc.Close()
+				continue
+			}
+			if rc, err = s.readPart(input, rc); err != nil {
+				return fmt.Errorf("Shapefile failed to read %s: %v", name, err)
+			}
+
+			key := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+
+			set := pending[key]
+			if set == nil {
+				set = &shapefileSet{name: strings.TrimSuffix(name, filepath.Ext(name))}
+			}
+
+			// A part received twice replaces the first
+			var part *io.ReadCloser
+			switch ext {
+			case ".shp":
+				part = &set.shp
+			case ".dbf":
+				part = &set.dbf
+			case ".prj":
+				part = &set.prj
+			}
+			if *part != nil {
+				(*part).Close()
+			}
+			*part = rc
+			pending[key] = set
+
+			// Only process once all parts have arrived. Sets without a .prj are handled when
+			// the input is finished
+			if set.shp == nil || set.dbf == nil || set.prj == nil {
+				continue
+			}
+			delete(pending, key)
+			if aborted, err := s.handleSet(stage, set); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (s *ShapefileProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// readPart reads a part of a shapefile, closing the reader it arrived in. A .shp on disk is kept
+// open as it is instead, as reading it doesn't hold anything else up
+func (s *ShapefileProcessor) readPart(input interface{}, rc io.ReadCloser) (io.ReadCloser, error) {
+	isShp := strings.EqualFold(filepath.Ext(ingest.PathOf(input)), ".shp")
+	if file, isFile := input.(*ingest.File); isFile && isShp {
+		if osFile, isOSFile := file.ReadCloser.(*os.File); isOSFile {
+			if info, err := osFile.Stat(); err == nil && info.Mode().IsRegular() {
+				return rc, nil
+			}
+		}
+	}
+	defer rc.Close()
+
+	if !isShp {
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	temp, err := ioutil.TempFile(s.opts.TempDir, "ingest-shapefile-*.shp")
+	if err != nil {
+		return nil, err
+	}
+	part := &tempPart{temp}
+	if _, err := io.Copy(temp, rc); err != nil {
+		part.Close()
+		return nil, err
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		part.Close()
+		return nil, err
+	}
+	return part, nil
+}
+
+// handleRemaining processes the sets which never received a .prj, in name order
+func (s *ShapefileProcessor) handleRemaining(stage *ingest.Stage, pending map[string]*shapefileSet) error {
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		set := pending[key]
+		delete(pending, key)
+
+		if set.shp == nil || set.dbf == nil {
+			set.Close()
+			return fmt.Errorf("Shapefile %s is missing its .shp or .dbf file", set.name)
+		}
+		if aborted, err := s.handleSet(stage, set); aborted || err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleSet emits a Feature for every shape in the set
+//
+// It returns true if the stage was aborted while emitting
+func (s *ShapefileProcessor) handleSet(stage *ingest.Stage, set *shapefileSet) (bool, error) {
+	log := s.logger.WithField("file", set.name)
+	log.Debug("Reading shapefile")
+
+	var projection string
+	if set.prj != nil {
+		wkt, err := ioutil.ReadAll(set.prj)
+		set.prj.Close()
+		if err != nil {
+			set.shp.Close()
+			set.dbf.Close()
+			return false, err
+		}
+		projection = strings.TrimSpace(string(wkt))
+	}
+
+	reader := shp.SequentialReaderFromExt(set.shp, set.dbf)
+	defer reader.Close()
+
+	fields := reader.Fields()
+	fieldMap := s.buildFieldMap(fields)
+
+	for reader.Next() {
+		feature, err := s.parseRecord(reader, fields, fieldMap)
+		if err != nil {
+			if s.opts.AbortOnFailedRecord {
+				return false, err
+			}
+			log.WithError(err).Warn("Error decoding shapefile record")
+			continue
+		}
+		feature.Projection = projection
+
+		select {
+		case <-stage.Abort:
+			return true, nil
+		case stage.Out <- feature:
+		}
+	}
+
+	return false, reader.Err()
+}
+
+// buildFieldMap maps the index of each DBF field to the indicies of the field on the mapper
+func (s *ShapefileProcessor) buildFieldMap(fields []shp.Field) map[int][]int {
+	if s.mapper == nil {
+		return nil
+	}
+
+	targetType := reflect.Indirect(reflect.ValueOf(s.mapper)).Type()
+	result := map[int][]int{}
+	for i, field := range fields {
+		result[i], _ = findFieldInStruct(field.String(), "dbf", targetType)
+	}
+	return result
+}
+
+// parseRecord builds a Feature from the current record
+func (s *ShapefileProcessor) parseRecord(reader shp.SequentialReader, fields []shp.Field, fieldMap map[int][]int) (Feature, error) {
+	_, shape := reader.Shape()
+	geometry, err := geometryFromShape(shape)
+	if err != nil {
+		return Feature{}, err
+	}
+
+	properties, err := s.parseAttributes(reader, fields, fieldMap)
+	if err != nil {
+		return Feature{}, err
+	}
+
+	return Feature{Geometry: geometry, Properties: properties}, nil
+}
+
+// parseAttributes decodes the attributes of the current record
+func (s *ShapefileProcessor) parseAttributes(reader shp.SequentialReader, fields []shp.Field, fieldMap map[int][]int) (interface{}, error) {
+	if s.mapper == nil {
+		result := map[string]interface{}{}
+		for i, field := range fields {
+			result[field.String()] = attributeValue(reader, i)
+		}
+		return result, nil
+	}
+
+	instance := reflect.New(reflect.Indirect(reflect.ValueOf(s.mapper)).Type())
+	for i := range fields {
+		fieldIndicies := fieldMap[i]
+		value := attributeValue(reader, i)
+		if len(fieldIndicies) == 0 || len(value) == 0 {
+			continue
+		}
+
+		field := instance.Elem()
+		for _, fieldIndex := range fieldIndicies {
+			field = field.Field(fieldIndex)
+		}
+
+		if err := setField(field, value, true, s.opts.DateFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.sendPtr {
+		return instance.Interface(), nil
+	}
+	return instance.Elem().Interface(), nil
+}
+
+// attributeValue returns the n-th attribute of the current record without its padding
+func attributeValue(reader shp.SequentialReader, n int) string {
+	return strings.Trim(reader.Attribute(n), " \x00")
+}
+
+// Close closes all of the parts of the set which were received
+func (set *shapefileSet) Close() {
+	for _, rc := range []io.ReadCloser{set.shp, set.dbf, set.prj} {
+		if rc != nil {
+			rc.Close()
+		}
+	}
+}
+
+// Close closes and removes the temporary file
+func (t *tempPart) Close() error {
+	err := t.File.Close()
+	if removeErr := os.Remove(t.File.Name()); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// geometryFromShape converts a shape to its GeoJSON equivalent
+func geometryFromShape(shape shp.Shape) (*Geometry, error) {
+	switch s := shape.(type) {
+	case *shp.Null:
+		return nil, nil
+	case *shp.Point:
+		return &Geometry{Type: "Point", Coordinates: []float64{s.X, s.Y}}, nil
+	case *shp.PointM:
+		return &Geometry{Type: "Point", Coordinates: []float64{s.X, s.Y}}, nil
+	case *shp.PointZ:
+		return &Geometry{Type: "Point", Coordinates: []float64{s.X, s.Y, s.Z}}, nil
+	case *shp.MultiPoint:
+		return &Geometry{Type: "MultiPoint", Coordinates: shapePositions(s.Points, nil)}, nil
+	case *shp.MultiPointM:
+		return &Geometry{Type: "MultiPoint", Coordinates: shapePositions(s.Points, nil)}, nil
+	case *shp.MultiPointZ:
+		return &Geometry{Type: "MultiPoint", Coordinates: shapePositions(s.Points, s.ZArray)}, nil
+	case *shp.PolyLine:
+		return lineGeometry(shapeParts(s.Parts, s.Points, nil)), nil
+	case *shp.PolyLineM:
+		return lineGeometry(shapeParts(s.Parts, s.Points, nil)), nil
+	case *shp.PolyLineZ:
+		return lineGeometry(shapeParts(s.Parts, s.Points, s.ZArray)), nil
+	case *shp.Polygon:
+		return polygonGeometry(shapeParts(s.Parts, s.Points, nil)), nil
+	case *shp.PolygonM:
+		return polygonGeometry(shapeParts(s.Parts, s.Points, nil)), nil
+	case *shp.PolygonZ:
+		return polygonGeometry(shapeParts(s.Parts, s.Points, s.ZArray)), nil
+	default:
+		return nil, fmt.Errorf("Unsupported shape type: %T", shape)
+	}
+}
+
+// shapePositions converts points (and optional z values) to GeoJSON positions
+func shapePositions(points []shp.Point, z []float64) [][]float64 {
+	result := make([][]float64, len(points))
+	for i, point := range points {
+		if i < len(z) {
+			result[i] = []float64{point.X, point.Y, z[i]}
+		} else {
+			result[i] = []float64{point.X, point.Y}
+		}
+	}
+	return result
+}
+
+// shapeParts splits the points of a shape into its parts
+func shapeParts(parts []int32, points []shp.Point, z []float64) [][][]float64 {
+	positions := shapePositions(points, z)
+	result := make([][][]float64, len(parts))
+	for i, start := range parts {
+		end := int32(len(positions))
+		if i+1 < len(parts) {
+			end = parts[i+1]
+		}
+		result[i] = positions[start:end]
+	}
+	return result
+}
+
+func lineGeometry(parts [][][]float64) *Geometry {
+	if len(parts) == 1 {
+		return &Geometry{Type: "LineString", Coordinates: parts[0]}
+	}
+	return &Geometry{Type: "MultiLineString", Coordinates: parts}
+}
+
+// polygonGeometry groups the rings of a shapefile polygon into polygons. Shapefiles
+// store outer rings clockwise and holes counter-clockwise, each hole following its outer ring
+func polygonGeometry(rings [][][]float64) *Geometry {
+	var polygons [][][][]float64
+	for _, ring := range rings {
+		if ringArea(ring) <= 0 || len(polygons) == 0 {
+			polygons = append(polygons, [][][]float64{ring})
+		} else {
+			last := len(polygons) - 1
+			polygons[last] = append(polygons[last], ring)
+		}
+	}
+
+	if len(polygons) == 1 {
+		return &Geometry{Type: "Polygon", Coordinates: polygons[0]}
+	}
+	return &Geometry{Type: "MultiPolygon", Coordinates: polygons}
+}
+
+// ringArea returns the signed area of a ring, which is negative for clockwise rings
+func ringArea(ring [][]float64) float64 {
+	var sum float64
+	for i := 0; i+1 < len(ring); i++ {
+		sum += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return sum / 2
+}
@@ -0,0 +1,70 @@
+package parse
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestShapefile(t *testing.T) {
+	type Asset struct {
+		ID     int     `dbf:"ID"`
+		Name   string  `dbf:"NAME"`
+		Height float64 `dbf:"HEIGHT"`
+	}
+
+	run := func(parser *ShapefileProcessor) (results []Feature, err error) {
+		out := make(chan interface{})
+		errChan := ingest.Open("../test/fixtures/shapefile").Then(parser).StreamTo(out).Build().RunAsync()
+		for rec := range out {
+			results = append(results, rec.(Feature))
+		}
+		return results, <-errChan
+	}
+
+	Convey("Shapefile", t, func() {
+		Convey("emits a feature for every shape", func() {
+			results, err := run(Shapefile(Asset{}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 3)
+			So(results[0].Geometry, ShouldResemble, &Geometry{Type: "Point", Coordinates: []float64{-89.4012, 43.0731}})
+			So(results[0].Projection, ShouldStartWith, `GEOGCS["GCS_WGS_1984"`)
+		})
+
+		Convey("decodes attributes to the mapper", func() {
+			results, err := run(Shapefile(&Asset{}))
+
+			So(err, ShouldBeNil)
+			So(results[1].Properties, ShouldResemble, &Asset{ID: 2, Name: "Manhattan Transformer", Height: 30.25})
+		})
+
+		Convey("decodes attributes to a map without a mapper", func() {
+			results, err := run(Shapefile(nil))
+
+			So(err, ShouldBeNil)
+			So(results[2].Properties, ShouldResemble, map[string]interface{}{"ID": "3", "NAME": "Boston Pole", "HEIGHT": "8.00"})
+		})
+	})
+
+	Convey("polygonGeometry", t, func() {
+		outer := [][]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+		hole := [][]float64{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}
+		other := [][]float64{{20, 20}, {20, 30}, {30, 30}, {20, 20}}
+
+		Convey("attaches holes to their outer ring", func() {
+			So(polygonGeometry([][][]float64{outer, hole}), ShouldResemble, &Geometry{
+				Type:        "Polygon",
+				Coordinates: [][][]float64{outer, hole},
+			})
+		})
+
+		Convey("emits a MultiPolygon for several outer rings", func() {
+			So(polygonGeometry([][][]float64{outer, hole, other}), ShouldResemble, &Geometry{
+				Type:        "MultiPolygon",
+				Coordinates: [][][][]float64{{outer, hole}, {other}},
+			})
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package parse
+
+import (
+	"reflect"
+
+	"github.com/urbint/ingest"
+)
+
+// sourceFileSetterType is the type of ingest.SourceFileSetter
+var sourceFileSetterType = reflect.TypeOf((*ingest.SourceFileSetter)(nil)).Elem()
+
+// withSourceFile tells the record which file it was parsed from if its mapper implements
+// ingest.SourceFileSetter, returning the record. Records sent as values are copied so that
+// the pointer receiver can set the file on them
+func withSourceFile(rec interface{}, file *ingest.File) interface{} {
+	if rec == nil || file == nil {
+		return rec
+	}
+	if setter, isSetter := rec.(ingest.SourceFileSetter); isSetter {
+		setter.SetSourceFile(file)
+		return rec
+	}
+
+	value := reflect.ValueOf(rec)
+	if !reflect.PtrTo(value.Type()).Implements(sourceFileSetterType) {
+		return rec
+	}
+	ptr := reflect.New(value.Type())
+	ptr.Elem().Set(value)
+	ptr.Interface().(ingest.SourceFileSetter).SetSourceFile(file)
+	return ptr.Elem().Interface()
+}
+
+// trackProgress tracks the progress of the stage through the file, which may be nil if the
+// input wasn't a named file
+func trackProgress(stage *ingest.Stage, file *ingest.File) *ingest.ProgressTracker {
+	if file == nil {
+		return stage.TrackProgress("", -1)
+	}
+	return stage.TrackProgress(file.Path, file.Size)
+}
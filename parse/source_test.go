@@ -0,0 +1,110 @@
+package parse
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+	"io/ioutil"
+	"sync"
+
+	"testing"
+)
+
+type sourcedRow struct {
+	Name   string `csv:"name" json:"name"`
+	Source string
+}
+
+func (s *sourcedRow) SetSourceFile(file *ingest.File) {
+	s.Source = file.Path
+}
+
+func TestSourceFile(t *testing.T) {
+	Convey("withSourceFile", t, func() {
+		file := ingest.NewFile(nil, "data/people.csv")
+
+		Convey("sets the file on pointer records", func() {
+			rec := withSourceFile(&sourcedRow{Name: "Bob"}, file)
+			So(rec, ShouldResemble, &sourcedRow{Name: "Bob", Source: "data/people.csv"})
+		})
+
+		Convey("sets the file on a copy of value records", func() {
+			rec := withSourceFile(sourcedRow{Name: "Bob"}, file)
+			So(rec, ShouldResemble, sourcedRow{Name: "Bob", Source: "data/people.csv"})
+		})
+
+		Convey("leaves other records alone", func() {
+			So(withSourceFile(map[string]interface{}{"name": "Bob"}, file), ShouldResemble, map[string]interface{}{"name": "Bob"})
+			So(withSourceFile(&sourcedRow{Name: "Bob"}, nil), ShouldResemble, &sourcedRow{Name: "Bob"})
+		})
+
+		Convey("is called by the parsers", func() {
+			parse := func(parser ingest.Runner, input interface{}) []interface{} {
+				stage := ingest.NewStage()
+				go func() {
+					stage.In <- input
+					close(stage.In)
+				}()
+
+				go func() {
+					parser.Run(stage)
+					close(stage.Out)
+				}()
+
+				results := []interface{}{}
+				for res := range stage.Out {
+					results = append(results, res)
+				}
+				return results
+			}
+
+			csvFile := ingest.NewFile(ioutil.NopCloser(bytes.NewBufferString("name\nBob\n")), "data/people.csv")
+			So(parse(CSV(sourcedRow{}), csvFile), ShouldResemble, []interface{}{
+				sourcedRow{Name: "Bob", Source: "data/people.csv"},
+			})
+
+			jsonFile := ingest.NewFile(ioutil.NopCloser(bytes.NewBufferString(`{"name":"Bob"}`)), "people.json")
+			So(parse(JSON(&sourcedRow{}), jsonFile), ShouldResemble, []interface{}{
+				&sourcedRow{Name: "Bob", Source: "people.json"},
+			})
+		})
+	})
+
+	Convey("Progress", t, func() {
+		// progressOf runs the parser over the input in a Job, returning the last Progress it reported
+		progressOf := func(parser ingest.Runner, input interface{}) ingest.Progress {
+			var mu sync.Mutex
+			var last ingest.Progress
+			out := make(chan interface{})
+			errChan := ingest.StartWith(input).Then(parser).StreamTo(out).Build().OnProgress(func(progress ingest.Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+				if progress.Stage == parser.Name() {
+					last = progress
+				}
+			}).RunAsync()
+			for range out {
+			}
+			So(<-errChan, ShouldBeNil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			return last
+		}
+
+		Convey("is reported by CSV", func() {
+			csvFile := ingest.NewFile(ioutil.NopCloser(bytes.NewBufferString("name\nBob\nAda\n")), "data/people.csv")
+			csvFile.Size = 13
+			So(progressOf(CSV(sourcedRow{}), csvFile), ShouldResemble, ingest.Progress{
+				Stage: "CSV Reader", File: "data/people.csv", BytesDone: 13, BytesTotal: 13, RecordsEmitted: 2,
+			})
+		})
+
+		Convey("is reported by JSON", func() {
+			jsonFile := ingest.NewFile(ioutil.NopCloser(bytes.NewBufferString(`{"name":"Bob"} {"name":"Ada"}`)), "people.json")
+			So(progressOf(JSON(&sourcedRow{}), jsonFile), ShouldResemble, ingest.Progress{
+				Stage: "JSON", File: "people.json", BytesDone: 29, BytesTotal: -1, RecordsEmitted: 2,
+			})
+		})
+	})
+}
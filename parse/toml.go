@@ -0,0 +1,212 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// A TOMLProcessor is used to process TOML documents via github.com/BurntSushi/toml
+	TOMLProcessor struct {
+		mapper      interface{}
+		newInstance func() reflect.Value
+		logger      ingest.Logger
+
+		opts    *TOMLOpts
+		sendPtr bool
+	}
+
+	// TOMLOpts are options used to configure a TOMLProcessor
+	TOMLOpts struct {
+		// Selector is a dot separated path to the value within the document that will be
+		// decoded. A "*" iterates the elements of an array, ie. "assets.*". It behaves like
+		// the Selector of JSONOpts
+		Selector string
+
+		// AbortOnFailedObject will cause the parser to stop if a record can't be decoded
+		AbortOnFailedObject bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// TOML returns a *parse.TOMLProcessor which will decode a TOML document to a specified struct.
+//
+// Each input is a single document. It emits one record, or one record per selected element
+// if a Selector is used
+func TOML(mapper interface{}, opts ...TOMLOpts) *TOMLProcessor {
+	opt := defaultTOMLOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	indirectType := reflect.Indirect(reflect.ValueOf(mapper)).Type()
+
+	processor := &TOMLProcessor{
+		mapper:      mapper,
+		newInstance: func() reflect.Value { return reflect.New(indirectType) },
+		sendPtr:     reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		opts:        &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultTOMLOpts() TOMLOpts {
+	return TOMLOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for TOMLProcessor
+func (t *TOMLProcessor) Name() string {
+	return "TOML"
+}
+
+// Run implements ingest.Runner for TOMLProcessor
+func (t *TOMLProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := t.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (t *TOMLProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// SetSelection implements ingest.Selectable for TOMLProcessor
+func (t *TOMLProcessor) SetSelection(selection ...string) {
+	if len(selection) > 0 {
+		t.opts.Selector = selection[0]
+	}
+}
+
+// handleIO decodes the document and emits the selected records
+//
+// It returns true if the stage was aborted while emitting
+func (t *TOMLProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	// TOML documents can't be streamed, so read the whole thing up front
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return false, err
+	}
+
+	decoders, err := t.selectValues(data)
+	if err != nil {
+		return false, err
+	}
+
+	for _, decode := range decoders {
+		rec := t.newInstance()
+		if err := decode(rec.Interface()); err != nil {
+			if t.opts.AbortOnFailedObject {
+				return false, err
+			}
+			t.logger.WithError(err).Warn("Error decoding TOML record")
+			continue
+		}
+
+		var toSend interface{}
+		if t.sendPtr {
+			toSend = rec.Interface()
+		} else {
+			toSend = rec.Elem().Interface()
+		}
+
+		select {
+		case <-stage.Abort:
+			return true, nil
+		case stage.Out <- withSourceFile(toSend, file):
+		}
+	}
+
+	return false, nil
+}
+
+// selectValues returns a decode function for each value selected from the document
+func (t *TOMLProcessor) selectValues(data []byte) ([]func(v interface{}) error, error) {
+	if t.opts.Selector == "" {
+		return []func(v interface{}) error{func(v interface{}) error {
+			return toml.Unmarshal(data, v)
+		}}, nil
+	}
+
+	// Decoding to Primitives defers decoding so that we can walk the selector first
+	var document map[string]toml.Primitive
+	meta, err := toml.Decode(string(data), &document)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.Split(t.opts.Selector, ".")
+	prim, found := document[path[0]]
+	if !found {
+		return nil, fmt.Errorf("Selector key %q not found", path[0])
+	}
+
+	return selectTOMLPrimitive(&meta, prim, path[1:])
+}
+
+// selectTOMLPrimitive walks the path from a single value
+func selectTOMLPrimitive(meta *toml.MetaData, prim toml.Primitive, path []string) ([]func(v interface{}) error, error) {
+	if len(path) == 0 {
+		return []func(v interface{}) error{func(v interface{}) error {
+			return meta.PrimitiveDecode(prim, v)
+		}}, nil
+	}
+
+	if path[0] == "*" {
+		var elements []toml.Primitive
+		if err := meta.PrimitiveDecode(prim, &elements); err != nil {
+			return nil, fmt.Errorf("Selector expected an array: %v", err)
+		}
+
+		var result []func(v interface{}) error
+		for _, element := range elements {
+			selected, err := selectTOMLPrimitive(meta, element, path[1:])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, selected...)
+		}
+		return result, nil
+	}
+
+	var table map[string]toml.Primitive
+	if err := meta.PrimitiveDecode(prim, &table); err != nil {
+		return nil, fmt.Errorf("Selector expected a table at %q: %v", path[0], err)
+	}
+
+	next, found := table[path[0]]
+	if !found {
+		return nil, fmt.Errorf("Selector key %q not found", path[0])
+	}
+	return selectTOMLPrimitive(meta, next, path[1:])
+}
@@ -0,0 +1,92 @@
+package parse
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestTOML(t *testing.T) {
+	var SampleTOML = `
+catalogue = "north"
+
+[[assets]]
+id = 1
+name = "Madison Substation"
+
+[[assets]]
+id = 2
+name = "Feeder 12"
+
+[codes.status]
+active = "A"
+retired = "R"
+`
+
+	type Asset struct {
+		ID   int    `toml:"id"`
+		Name string `toml:"name"`
+	}
+
+	type Catalogue struct {
+		Name   string  `toml:"catalogue"`
+		Assets []Asset `toml:"assets"`
+	}
+
+	run := func(parser *TOMLProcessor) (results []interface{}, err error) {
+		stage := ingest.NewStage()
+		go func() {
+			stage.In <- bytes.NewBufferString(SampleTOML)
+			close(stage.In)
+		}()
+
+		done := make(chan bool)
+		go func() {
+			err = parser.Run(stage)
+			close(stage.Out)
+			close(done)
+		}()
+
+		for res := range stage.Out {
+			results = append(results, res)
+		}
+		<-done
+		return results, err
+	}
+
+	Convey("TOML", t, func() {
+		Convey("emits the document", func() {
+			results, err := run(TOML(&Catalogue{}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 1)
+			So(results[0].(*Catalogue).Assets, ShouldHaveLength, 2)
+		})
+
+		Convey("emits a record per selected array element", func() {
+			results, err := run(TOML(Asset{}, TOMLOpts{Selector: "assets.*"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{
+				Asset{ID: 1, Name: "Madison Substation"},
+				Asset{ID: 2, Name: "Feeder 12"},
+			})
+		})
+
+		Convey("selects nested tables", func() {
+			results, err := run(TOML(map[string]string{}, TOMLOpts{Selector: "codes.status"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{map[string]string{"active": "A", "retired": "R"}})
+		})
+
+		Convey("fails when the selection is missing", func() {
+			_, err := run(TOML(Asset{}, TOMLOpts{Selector: "missing.*"}))
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
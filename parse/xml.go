@@ -0,0 +1,159 @@
+package parse
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// An XMLProcessor is used to process XML via encoding/xml
+	XMLProcessor struct {
+		mapper      interface{}
+		newInstance func() reflect.Value
+		logger      ingest.Logger
+
+		opts    *XMLOpts
+		sendPtr bool
+	}
+
+	// XMLOpts are options used to configure an XMLProcessor
+	XMLOpts struct {
+		// Element is the local name of the elements that will be decoded, at any depth.
+		// If not specified, every child of the root element is decoded
+		Element string
+
+		// AbortOnFailedObject will cause the parser to stop if an element can't be decoded
+		AbortOnFailedObject bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// XML returns a *parse.XMLProcessor which will decode XML elements to a specified struct
+func XML(mapper interface{}, opts ...XMLOpts) *XMLProcessor {
+	opt := defaultXMLOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	indirectType := reflect.Indirect(reflect.ValueOf(mapper)).Type()
+
+	processor := &XMLProcessor{
+		mapper:      mapper,
+		newInstance: func() reflect.Value { return reflect.New(indirectType) },
+		sendPtr:     reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		opts:        &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultXMLOpts() XMLOpts {
+	return XMLOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for XMLProcessor
+func (x *XMLProcessor) Name() string {
+	return "XML"
+}
+
+// Run implements ingest.Runner for XMLProcessor
+func (x *XMLProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := x.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (x *XMLProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// SetSelection implements ingest.Selectable for XMLProcessor, setting the Element to decode
+func (x *XMLProcessor) SetSelection(selection ...string) {
+	if len(selection) > 0 {
+		x.opts.Element = selection[0]
+	}
+}
+
+// handleIO decodes the matching elements of the input and emits them to stage.Out
+//
+// It returns true if the stage was aborted while emitting
+func (x *XMLProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		switch element := token.(type) {
+		case xml.EndElement:
+			depth--
+		case xml.StartElement:
+			depth++
+
+			isMatch := depth == 2 && x.opts.Element == ""
+			if x.opts.Element != "" && element.Name.Local == x.opts.Element {
+				isMatch = true
+			}
+			if !isMatch {
+				continue
+			}
+
+			// DecodeElement consumes the matching EndElement
+			depth--
+
+			rec := x.newInstance()
+			if err := decoder.DecodeElement(rec.Interface(), &element); err != nil {
+				if x.opts.AbortOnFailedObject {
+					return false, err
+				}
+				x.logger.WithError(err).Warn("Error decoding XML element")
+				continue
+			}
+
+			var toSend interface{}
+			if x.sendPtr {
+				toSend = rec.Interface()
+			} else {
+				toSend = rec.Elem().Interface()
+			}
+
+			select {
+			case <-stage.Abort:
+				return true, nil
+			case stage.Out <- withSourceFile(toSend, file):
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package parse
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestXML(t *testing.T) {
+	var SampleXML = `<?xml version="1.0"?>
+<export>
+	<people>
+		<person id="1"><name>Bob</name></person>
+		<person id="2"><name>Alice</name></person>
+	</people>
+	<generated>2017-01-01</generated>
+</export>`
+
+	type Person struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	run := func(parser *XMLProcessor) (results []interface{}, err error) {
+		stage := ingest.NewStage()
+		go func() {
+			stage.In <- bytes.NewBufferString(SampleXML)
+			close(stage.In)
+		}()
+
+		done := make(chan bool)
+		go func() {
+			err = parser.Run(stage)
+			close(stage.Out)
+			close(done)
+		}()
+
+		for res := range stage.Out {
+			results = append(results, res)
+		}
+		<-done
+		return results, err
+	}
+
+	Convey("XML", t, func() {
+		Convey("decodes the selected elements at any depth", func() {
+			results, err := run(XML(&Person{}, XMLOpts{Element: "person"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{&Person{ID: 1, Name: "Bob"}, &Person{ID: 2, Name: "Alice"}})
+		})
+
+		Convey("decodes the children of the root element by default", func() {
+			results, err := run(XML(struct {
+				Generated string `xml:"generated"`
+			}{}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+		})
+	})
+}
@@ -0,0 +1,205 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// A YAMLProcessor is used to process YAML documents via gopkg.in/yaml.v3
+	YAMLProcessor struct {
+		mapper      interface{}
+		newInstance func() reflect.Value
+		logger      ingest.Logger
+
+		opts    *YAMLOpts
+		sendPtr bool
+	}
+
+	// YAMLOpts are options used to configure a YAMLProcessor
+	YAMLOpts struct {
+		// Selector is a dot separated path to the value within each document that will be
+		// decoded. A "*" iterates the elements of a list, ie. "assets.*". It behaves like
+		// the Selector of JSONOpts
+		Selector string
+
+		// AbortOnFailedObject will cause the parser to stop if a document can't be decoded
+		AbortOnFailedObject bool
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// YAML returns a *parse.YAMLProcessor which will decode YAML documents to a specified struct.
+//
+// Streams of multiple documents (separated by "---") emit one record per document, or
+// one record per selected element if a Selector is used
+func YAML(mapper interface{}, opts ...YAMLOpts) *YAMLProcessor {
+	opt := defaultYAMLOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	indirectType := reflect.Indirect(reflect.ValueOf(mapper)).Type()
+
+	processor := &YAMLProcessor{
+		mapper:      mapper,
+		newInstance: func() reflect.Value { return reflect.New(indirectType) },
+		sendPtr:     reflect.TypeOf(mapper).Kind() == reflect.Ptr,
+		opts:        &opt,
+	}
+	processor.logger = opt.Logger.WithField("processor", processor.Name())
+
+	return processor
+}
+
+func defaultYAMLOpts() YAMLOpts {
+	return YAMLOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for YAMLProcessor
+func (y *YAMLProcessor) Name() string {
+	return "YAML"
+}
+
+// Run implements ingest.Runner for YAMLProcessor
+func (y *YAMLProcessor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := y.handleIO(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (y *YAMLProcessor) SkipAbortErr() bool {
+	return true
+}
+
+// SetSelection implements ingest.Selectable for YAMLProcessor
+func (y *YAMLProcessor) SetSelection(selection ...string) {
+	if len(selection) > 0 {
+		y.opts.Selector = selection[0]
+	}
+}
+
+// handleIO decodes every document of the input and emits the selected records
+//
+// It returns true if the stage was aborted while emitting
+func (y *YAMLProcessor) handleIO(stage *ingest.Stage, rc io.ReadCloser, file *ingest.File) (bool, error) {
+	defer rc.Close()
+
+	decoder := yaml.NewDecoder(rc)
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			// A syntax error leaves the decoder unable to find the next document
+			return false, err
+		}
+
+		var path []string
+		if y.opts.Selector != "" {
+			path = strings.Split(y.opts.Selector, ".")
+		}
+
+		nodes, err := selectYAMLNodes(&document, path)
+		if err != nil {
+			if y.opts.AbortOnFailedObject {
+				return false, err
+			}
+			y.logger.WithError(err).Warn("Error selecting from YAML document")
+			continue
+		}
+
+		for _, node := range nodes {
+			rec := y.newInstance()
+			if err := node.Decode(rec.Interface()); err != nil {
+				if y.opts.AbortOnFailedObject {
+					return false, err
+				}
+				y.logger.WithError(err).WithField("line", node.Line).Warn("Error decoding YAML record")
+				continue
+			}
+
+			var toSend interface{}
+			if y.sendPtr {
+				toSend = rec.Interface()
+			} else {
+				toSend = rec.Elem().Interface()
+			}
+
+			select {
+			case <-stage.Abort:
+				return true, nil
+			case stage.Out <- withSourceFile(toSend, file):
+			}
+		}
+	}
+}
+
+// selectYAMLNodes walks the path from node, returning the nodes it leads to
+func selectYAMLNodes(node *yaml.Node, path []string) ([]*yaml.Node, error) {
+	for node.Kind == yaml.DocumentNode || node.Kind == yaml.AliasNode {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		} else if len(node.Content) > 0 {
+			node = node.Content[0]
+		} else {
+			return nil, nil
+		}
+	}
+
+	if len(path) == 0 {
+		return []*yaml.Node{node}, nil
+	}
+
+	if path[0] == "*" {
+		if node.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("Selector expected a list at line %d", node.Line)
+		}
+
+		var result []*yaml.Node
+		for _, child := range node.Content {
+			selected, err := selectYAMLNodes(child, path[1:])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, selected...)
+		}
+		return result, nil
+	}
+
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == path[0] {
+				return selectYAMLNodes(node.Content[i+1], path[1:])
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("Selector key %q not found at line %d", path[0], node.Line)
+}
@@ -0,0 +1,91 @@
+package parse
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	. "github.com/urbint/conveyer"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestYAML(t *testing.T) {
+	var SampleYAML = `---
+catalogue: north
+assets:
+  - id: 1
+    name: Madison Substation
+  - id: 2
+    name: Feeder 12
+---
+catalogue: south
+assets:
+  - id: 3
+    name: Boston Pole
+`
+
+	type Asset struct {
+		ID   int    `yaml:"id"`
+		Name string `yaml:"name"`
+	}
+
+	type Catalogue struct {
+		Name   string  `yaml:"catalogue"`
+		Assets []Asset `yaml:"assets"`
+	}
+
+	run := func(parser *YAMLProcessor) (results []interface{}, err error) {
+		stage := ingest.NewStage()
+		go func() {
+			stage.In <- bytes.NewBufferString(SampleYAML)
+			close(stage.In)
+		}()
+
+		done := make(chan bool)
+		go func() {
+			err = parser.Run(stage)
+			close(stage.Out)
+			close(done)
+		}()
+
+		for res := range stage.Out {
+			results = append(results, res)
+		}
+		<-done
+		return results, err
+	}
+
+	Convey("YAML", t, func() {
+		Convey("emits a record per document", func() {
+			results, err := run(YAML(Catalogue{}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[1], ShouldResemble, Catalogue{Name: "south", Assets: []Asset{{ID: 3, Name: "Boston Pole"}}})
+		})
+
+		Convey("emits a record per selected list element", func() {
+			results, err := run(YAML(&Asset{}, YAMLOpts{Selector: "assets.*"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 3)
+			So(results, ShouldContainSomethingLike, &Asset{ID: 2, Name: "Feeder 12"})
+		})
+
+		Convey("selects an entire value", func() {
+			results, err := run(YAML([]Asset{}, YAMLOpts{Selector: "assets"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0], ShouldHaveLength, 2)
+		})
+
+		Convey("skips documents missing the selection", func() {
+			results, err := run(YAML(Asset{}, YAMLOpts{Selector: "missing.*"}))
+
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+		})
+	})
+}
@@ -1,5 +1,7 @@
 package ingest
 
+import "time"
+
 // A Pipeline is a sequence of ingest.Processors that are linked together
 //
 // The processors will share common control channels (Err, Quit) which are managed
@@ -90,13 +92,47 @@ type StreamToOpt struct {
 // Returning an error will cause the pipeline to fail
 // An optional name can be specified as a string argument and will be used for logging
 func (p *Pipeline) ForEach(fn TransformFn, nameArg ...string) *Pipeline {
-	var name string
-	if len(nameArg) == 0 {
-		name = "Unknown"
-	} else {
-		name = nameArg[0]
-	}
-	return p.Then(NewTransformStream(name, fn))
+	return p.Then(NewTransformStream(stageName(nameArg), fn))
+}
+
+// Filter only forwards the records for which fn returns true to the later stages
+//
+// Returning an error will cause the pipeline to fail
+// An optional name can be specified as a string argument and will be used for logging
+func (p *Pipeline) Filter(fn FilterFn, nameArg ...string) *Pipeline {
+	return p.Then(NewFilterStream(stageName(nameArg), fn))
+}
+
+// FlatMap runs a function on each record in the pipeline, forwarding each record it passes to
+// emit to the later stages. It may emit any number of records, including none
+//
+// Returning an error will cause the pipeline to fail
+// An optional name can be specified as a string argument and will be used for logging
+func (p *Pipeline) FlatMap(fn FlatMapFn, nameArg ...string) *Pipeline {
+	return p.Then(NewFlatMapStream(stageName(nameArg), fn))
+}
+
+// Reduce combines the records in the pipeline into a single result, starting from init, and
+// forwards it to the later stages once every record has been combined
+//
+// init is used as it is, so a map or pointer will be shared between runs of the Job
+// Returning an error will cause the pipeline to fail
+// An optional name can be specified as a string argument and will be used for logging
+func (p *Pipeline) Reduce(init interface{}, fn ReduceFn, nameArg ...string) *Pipeline {
+	return p.Then(NewReduceStream(stageName(nameArg), init, fn))
+}
+
+// Batch groups the records in the pipeline into []interface{} batches of up to size records
+//
+// A partial batch is emitted once maxWait has passed since its first record (unless maxWait is 0),
+// and when the stage before it has finished
+func (p *Pipeline) Batch(size int, maxWait time.Duration) *Pipeline {
+	return p.Then(NewBatcher(size, maxWait))
+}
+
+// Unbatch emits each record of the slices in the pipeline, undoing Batch
+func (p *Pipeline) Unbatch() *Pipeline {
+	return p.Then(NewUnbatcher())
 }
 
 // Build builds the pipeline and returns a Job control structure
@@ -104,6 +140,14 @@ func (p *Pipeline) Build() *Job {
 	return NewJob(*p)
 }
 
+// stageName returns the optional name passed to ForEach and the like, or "Unknown"
+func stageName(nameArg []string) string {
+	if len(nameArg) == 0 {
+		return "Unknown"
+	}
+	return nameArg[0]
+}
+
 // lastTargetableRunner returns the last runner that can be targeted (ie. does not implement PassOnAddTarget)
 func (p *Pipeline) lastTargetableRunner() Runner {
 	if len(p.configs) == 0 {
@@ -0,0 +1,251 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// The compression formats understood by the Decompressor
+const (
+	formatGzip  = "gzip"
+	formatBzip2 = "bzip2"
+	formatXz    = "xz"
+)
+
+// compressionMagic are the leading bytes of each compression format
+var compressionMagic = map[string][]byte{
+	formatGzip:  {0x1f, 0x8b},
+	formatBzip2: []byte("BZh"),
+	formatXz:    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+}
+
+// compressionExts maps the file extensions of each compression format to the
+// extension of the decompressed file
+var compressionExts = map[string]map[string]string{
+	formatGzip:  {".gz": "", ".gzip": "", ".tgz": ".tar"},
+	formatBzip2: {".bz2": "", ".bz": "", ".tbz2": ".tar", ".tbz": ".tar"},
+	formatXz:    {".xz": "", ".txz": ".tar"},
+}
+
+type (
+	// Decompressor is a Runner that will decompress each file it receives as it is read.
+	// Each is emitted as an *ingest.File whose Parent is the compressed file
+	Decompressor struct {
+		name   string
+		format string
+		filter []*regexp.Regexp
+		logger ingest.Logger
+		limits *limiter
+	}
+
+	// DecompressOpts are options used to configure a Decompressor. Files exceeding its limits
+	// fail the job
+	DecompressOpts struct {
+		// MaxUncompressedBytes is the most bytes that may be decompressed from each file.
+		// Defaults to no limit
+		MaxUncompressedBytes int64
+
+		// MaxRatio is the largest ratio of decompressed to compressed size allowed for each file,
+		// which is enforced once 1MB has been decompressed. Defaults to no limit
+		MaxRatio float64
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// Gunzip receives gzipped files and emits them decompressed, named without their extension
+//
+// It is selectable, allowing you to use a Regex to filter by the decompressed name
+func Gunzip(opts ...DecompressOpts) *Decompressor {
+	return newDecompressor("Gunzip", formatGzip, opts)
+}
+
+// Bunzip2 receives bzip2 files and emits them decompressed, named without their extension
+//
+// It is selectable, allowing you to use a Regex to filter by the decompressed name
+func Bunzip2(opts ...DecompressOpts) *Decompressor {
+	return newDecompressor("Bunzip2", formatBzip2, opts)
+}
+
+// Unxz receives xz files and emits them decompressed, named without their extension
+//
+// It is selectable, allowing you to use a Regex to filter by the decompressed name
+func Unxz(opts ...DecompressOpts) *Decompressor {
+	return newDecompressor("Unxz", formatXz, opts)
+}
+
+// Decompress receives files compressed with gzip, bzip2 or xz, detected by their leading bytes,
+// and emits them decompressed, named without their extension. Files that aren't compressed are
+// emitted as they are
+//
+// It is selectable, allowing you to use a Regex to filter by the decompressed name
+func Decompress(opts ...DecompressOpts) *Decompressor {
+	return newDecompressor("Decompress", "", opts)
+}
+
+func newDecompressor(name string, format string, opts []DecompressOpts) *Decompressor {
+	opt := defaultDecompressOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	return &Decompressor{
+		name:   name,
+		format: format,
+		logger: opt.Logger.WithField("processor", strings.ToLower(name)),
+		limits: &limiter{
+			runner:   name,
+			maxBytes: opt.MaxUncompressedBytes,
+			maxRatio: opt.MaxRatio,
+		},
+	}
+}
+
+func defaultDecompressOpts() DecompressOpts {
+	return DecompressOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for Decompressor
+func (d *Decompressor) Name() string {
+	return d.name
+}
+
+// Run implements ingest.Runner for Decompressor
+func (d *Decompressor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			name := ingest.PathOf(input)
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+
+			compressed := &countingReader{ReadCloser: rc}
+			out, err := decompress(compressed, name, d.format)
+			if err != nil {
+				rc.Close()
+				return fmt.Errorf("%s failed to open %s: %v", d.name, name, err)
+			}
+
+			guard := d.limits.archive(name)
+			out.Reader = guard.limitTotal(guard.limitRatio(out.Reader, out.name, compressed.Count))
+
+			if !filterMatch(d.filter, out.name) {
+				out.Close()
+				continue
+			}
+
+			file := ingest.NewFile(out, out.name)
+			file.Parent = ingest.FileOf(input)
+
+			d.logger.WithField("file", out.name).Debug("decompressing")
+			select {
+			case <-stage.Abort:
+				out.Close()
+				return nil
+			case stage.Out <- file:
+			}
+		}
+	}
+}
+
+// SetSelection implements ingest.Selectable for Decompressor
+//
+// It will filter the decompressed files for file names that match
+// the regex provided by the selection
+func (d *Decompressor) SetSelection(selections ...string) {
+	for _, selection := range selections {
+		d.filter = append(d.filter, regexp.MustCompile(selection))
+	}
+}
+
+// OnPipelineDone implements ingest.OnDone for Decompressor, failing if a limit was exceeded
+// while the files were being read
+func (d *Decompressor) OnPipelineDone() error {
+	return d.limits.reset()
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (d *Decompressor) SkipAbortErr() bool {
+	return true
+}
+
+// decompress wraps rc in a decompressor for format. If format is empty it is detected,
+// and rc is returned as is if it isn't compressed
+func decompress(rc io.ReadCloser, name string, format string) (*entry, error) {
+	buffered := bufio.NewReader(rc)
+
+	if format == "" {
+		format = detectCompression(buffered)
+		if format == "" {
+			return &entry{Reader: buffered, name: name, closers: []io.Closer{rc}}, nil
+		}
+	}
+
+	var reader io.Reader
+	var closers []io.Closer
+	switch format {
+	case formatGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		reader, closers = gz, []io.Closer{gz}
+	case formatBzip2:
+		reader = bzip2.NewReader(buffered)
+	case formatXz:
+		xzReader, err := xz.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		reader = xzReader
+	}
+
+	return &entry{
+		Reader:  reader,
+		name:    decompressedName(name, format),
+		closers: append(closers, rc),
+	}, nil
+}
+
+// detectCompression returns the compression format of the reader, or an empty string if
+// it doesn't appear to be compressed
+func detectCompression(reader *bufio.Reader) string {
+	head, _ := reader.Peek(6)
+	for format, magic := range compressionMagic {
+		if bytes.HasPrefix(head, magic) {
+			return format
+		}
+	}
+	return ""
+}
+
+// decompressedName removes the extension of the compression format from name
+func decompressedName(name string, format string) string {
+	ext := filepath.Ext(name)
+	if replacement, isCompressedExt := compressionExts[format][strings.ToLower(ext)]; isCompressedExt {
+		return strings.TrimSuffix(name, ext) + replacement
+	}
+	return name
+}
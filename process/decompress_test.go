@@ -0,0 +1,86 @@
+package process
+
+import (
+	"io"
+	"io/ioutil"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	Convey("Decompress", t, func() {
+		out := make(chan interface{})
+		expected, _ := ioutil.ReadFile("../test/fixtures/csvtest/file1.csv")
+
+		readAll := func() (names []string, contents []string) {
+			for file := range out {
+				asCloser := file.(io.ReadCloser)
+				content, err := ioutil.ReadAll(asCloser)
+				So(err, ShouldBeNil)
+				asCloser.Close()
+
+				names = append(names, file.(*ingest.File).Path)
+				contents = append(contents, string(content))
+			}
+			return names, contents
+		}
+
+		Convey("Gunzip decompresses gzip files", func() {
+			err := ingest.Open("../test/fixtures/compressed/people.csv.gz").Then(Gunzip()).StreamTo(out).Build().RunAsync()
+			names, contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"../test/fixtures/compressed/people.csv"})
+			So(contents, ShouldResemble, []string{string(expected)})
+		})
+
+		Convey("Bunzip2 decompresses bzip2 files", func() {
+			err := ingest.Open("../test/fixtures/compressed/people.csv.bz2").Then(Bunzip2()).StreamTo(out).Build().RunAsync()
+			_, contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldResemble, []string{string(expected)})
+		})
+
+		Convey("Unxz decompresses xz files", func() {
+			err := ingest.Open("../test/fixtures/compressed/people.csv.xz").Then(Unxz()).StreamTo(out).Build().RunAsync()
+			_, contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldResemble, []string{string(expected)})
+		})
+
+		Convey("Decompress detects the format of each file", func() {
+			err := ingest.Open("../test/fixtures/compressed").Then(Decompress()).StreamTo(out).Build().RunAsync()
+			names, contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(names, ShouldHaveLength, 3)
+			for i := range names {
+				So(names[i], ShouldEndWith, "people.csv")
+				So(contents[i], ShouldEqual, string(expected))
+			}
+		})
+
+		Convey("is selectable by the decompressed name", func() {
+			err := ingest.Open("../test/fixtures/compressed").
+				Then(Decompress()).
+				Then(ingest.Select(`\.csv$`)).
+				StreamTo(out).Build().RunAsync()
+			names, _ := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(names, ShouldHaveLength, 3)
+		})
+
+		Convey("Gunzip fails on files that aren't gzipped", func() {
+			err := ingest.Open("../test/fixtures/csvtest/file1.csv").Then(Gunzip()).StreamTo(out).Build().RunAsync()
+			readAll()
+
+			So(<-err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,136 @@
+package process
+
+import (
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/urbint/ingest"
+)
+
+// entry is a reader of a file produced by the process runners, along with its name
+type entry struct {
+	io.Reader
+	name string
+
+	// closers are closed in order when the entry is closed
+	closers []io.Closer
+}
+
+// Close implements io.Closer for entry
+func (e *entry) Close() error {
+	var result error
+	for _, closer := range e.closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// heldEntry is an entry that holds on to resources of the runner that emitted it, ie. a file
+// within a tar archive, which can only be read sequentially, or within a zip archive, which must
+// stay open until all of its files are read.
+//
+// It is released once it is read to the end or closed, letting the runner continue or free
+// the resources
+type heldEntry struct {
+	reader  io.Reader
+	closers []io.Closer
+
+	// onRelease is called once the entry is released, after its closers are closed
+	onRelease func()
+
+	mu       sync.Mutex
+	done     bool
+	released chan bool
+}
+
+func newHeldEntry(reader io.Reader, closers ...io.Closer) *heldEntry {
+	return &heldEntry{
+		reader:   reader,
+		closers:  closers,
+		released: make(chan bool),
+	}
+}
+
+// emitHeld sends the file to stage.Out and waits for the entry it reads from to be released
+//
+// It returns true if the stage was aborted, in which case the entry is released
+func emitHeld(stage *ingest.Stage, held *heldEntry, file *ingest.File) bool {
+	file.ReadCloser = held
+	select {
+	case <-stage.Abort:
+		held.Close()
+		return true
+	case stage.Out <- file:
+	}
+
+	select {
+	case <-stage.Abort:
+		held.Close()
+		return true
+	case <-held.released:
+		return false
+	}
+}
+
+// Read implements io.Reader for heldEntry. Once the end of the file is reached the
+// runner is free to move on
+func (h *heldEntry) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.done {
+		return 0, io.EOF
+	}
+
+	n, err := h.reader.Read(p)
+	if err == io.EOF {
+		h.releaseLocked()
+	}
+	return n, err
+}
+
+// Close implements io.Closer for heldEntry, letting the runner move on
+func (h *heldEntry) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.releaseLocked()
+}
+
+func (h *heldEntry) releaseLocked() error {
+	if h.done {
+		return nil
+	}
+	h.done = true
+	close(h.released)
+
+	var result error
+	for _, closer := range h.closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	if h.onRelease != nil {
+		h.onRelease()
+	}
+	return result
+}
+
+// filterMatch checks whether the name matches any of the filters.
+//
+// If no filters are specified it will return true
+func filterMatch(filter []*regexp.Regexp, name string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+
+	for _, regex := range filter {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
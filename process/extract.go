@@ -0,0 +1,344 @@
+package process
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// zipMagic are the leading bytes of a zip archive, or of an empty one
+var zipMagic = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}
+
+// tarMagic is found at tarMagicOffset in the header of ustar and GNU tar archives
+var tarMagic = []byte("ustar")
+
+const tarMagicOffset = 257
+
+type (
+	// An Extractor is a Runner that recursively extracts nested archives and compressed files
+	Extractor struct {
+		filter []*regexp.Regexp
+		logger ingest.Logger
+		opts   *ExtractOpts
+		spool  *spooler
+		limits *limiter
+	}
+
+	// ExtractOpts are options used to configure an Extractor
+	ExtractOpts struct {
+		// MaxDepth is the number of archive and compression layers that will be descended
+		// through. Anything nested deeper is emitted as is. Defaults to 5
+		MaxDepth int
+
+		// TempDir is the directory in which nested zip archives are spooled, since they need
+		// random access. Defaults to the system temp directory
+		TempDir string
+
+		// MaxSpoolSize is the largest nested zip archive, in bytes, that will be spooled. Defaults to 4GB
+		MaxSpoolSize int64
+
+		// MaxEntries is the most entries that may be found across all of the archives nested
+		// within each input. Defaults to no limit
+		MaxEntries int
+
+		// MaxUncompressedBytes is the most bytes that may be extracted from each input.
+		// Defaults to no limit
+		MaxUncompressedBytes int64
+
+		// MaxRatio is the largest ratio of uncompressed to compressed size allowed for each
+		// compressed layer, which is enforced once 1MB has been extracted. Defaults to no limit
+		MaxRatio float64
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// Extract receives files and recursively descends through any zip, tar, gzip, bzip2 and xz
+// layers within them, emitting the files found at the bottom.
+//
+// Each file is emitted as an *ingest.File whose Path is its virtual path through the archives
+// containing it, ie. outer.zip/inner.tar.gz/data/file.csv, and whose Parent is the archive or
+// compressed file it was extracted from. Compressed files are named without their extension.
+// Each file must be read to the end or closed before the next is emitted. The names of the files
+// within archives are cleaned of leading slashes, and inputs with names that escape their archive
+// (ie. ../etc/passwd) or exceed the limits set in opts will fail the job.
+//
+// It is selectable, allowing you to use a Regex to filter said files by their virtual path
+func Extract(opts ...ExtractOpts) *Extractor {
+	opt := defaultExtractOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	return &Extractor{
+		logger: opt.Logger.WithField("processor", "extract"),
+		opts:   &opt,
+		spool:  &spooler{tempDir: opt.TempDir, maxSize: opt.MaxSpoolSize},
+		limits: &limiter{
+			runner:     "Extract",
+			maxEntries: opt.MaxEntries,
+			maxBytes:   opt.MaxUncompressedBytes,
+			maxRatio:   opt.MaxRatio,
+		},
+	}
+}
+
+func defaultExtractOpts() ExtractOpts {
+	return ExtractOpts{
+		MaxDepth:     5,
+		TempDir:      os.TempDir(),
+		MaxSpoolSize: 4 << 30,
+		Logger:       ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for Extractor
+func (x *Extractor) Name() string {
+	return "Extract"
+}
+
+// Run implements ingest.Runner for Extractor
+func (x *Extractor) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			file := ingest.FileOf(input)
+			if file == nil {
+				rc, err := utils.ToIOReadCloser(input)
+				if err != nil {
+					return err
+				}
+				file = ingest.NewFile(rc, "")
+			}
+
+			guard := x.limits.archive(file.Path)
+			if aborted, err := x.extract(stage, guard, file, file.Path, 0); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// OnPipelineDone implements ingest.OnDone for Extractor, removing any archives spooled to disk.
+// It fails if a limit was exceeded while the files were being read
+func (x *Extractor) OnPipelineDone() error {
+	exceeded := x.limits.reset()
+	if err := x.spool.cleanup(); err != nil && exceeded == nil {
+		return err
+	}
+	return exceeded
+}
+
+// SetSelection implements ingest.Selectable for Extractor
+//
+// It will filter the extracted files for virtual paths that match
+// the regex provided by the selection
+func (x *Extractor) SetSelection(selections ...string) {
+	for _, selection := range selections {
+		x.filter = append(x.filter, regexp.MustCompile(selection))
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (x *Extractor) SkipAbortErr() bool {
+	return true
+}
+
+// extract descends into the file if it is an archive or compressed, otherwise emitting it
+// if it matches the filter. The file is closed once it has been handled.
+//
+// The Path of the file is its virtual path, and container is the path used for the files within
+// it, which keeps the extensions of any compression layers (ie. inner.tar.gz rather than inner.tar).
+// guard enforces the limits across everything extracted from the original input
+//
+// It returns true if the stage was aborted
+func (x *Extractor) extract(stage *ingest.Stage, guard *archiveGuard, file *ingest.File, container string, depth int) (bool, error) {
+	descend := depth < x.opts.MaxDepth
+
+	// Zips that can already be read at random don't need to be spooled
+	if readerAt, size, ok := randomAccess(file); ok && descend {
+		head := make([]byte, 4)
+		if n, _ := readerAt.ReadAt(head, 0); isZip(head[:n]) {
+			defer file.Close()
+			return x.extractZip(stage, guard, file, readerAt, size, container, depth)
+		}
+	}
+
+	compressed := &countingReader{ReadCloser: file.ReadCloser}
+	buffered := bufio.NewReader(compressed)
+	head, _ := buffered.Peek(tarMagicOffset + len(tarMagic))
+	format := detectCompression(buffered)
+
+	switch {
+	case !descend:
+		if isZip(head) || isTar(head, file.Path) || format != "" {
+			x.logger.WithField("file", file.Path).Warn("Not extracting archive nested deeper than MaxDepth")
+		}
+
+	case format != "":
+		decompressed, err := decompress(&entry{Reader: buffered, closers: []io.Closer{file}}, file.Path, format)
+		if err != nil {
+			file.Close()
+			return false, fmt.Errorf("Extract failed to decompress %s: %v", file.Path, err)
+		}
+		decompressed.Reader = guard.limitRatio(decompressed.Reader, file.Path, compressed.Count)
+
+		inner := ingest.NewFile(decompressed, decompressed.name)
+		inner.Parent = file
+		return x.extract(stage, guard, inner, container, depth+1)
+
+	case isZip(head):
+		defer file.Close()
+		spooled, size, err := x.spool.spool(buffered)
+		if err != nil {
+			return false, fmt.Errorf("Extract failed to spool %s: %v", file.Path, err)
+		}
+		defer spooled.Close()
+		return x.extractZip(stage, guard, file, spooled, size, container, depth)
+
+	case isTar(head, file.Path):
+		defer file.Close()
+		return x.extractTar(stage, guard, file, buffered, container, depth)
+	}
+
+	if !filterMatch(x.filter, file.Path) {
+		file.Close()
+		return false, nil
+	}
+
+	x.logger.WithField("file", file.Path).Debug("found match")
+	leaf := *file
+	if aborted := emitHeld(stage, newHeldEntry(guard.limitTotal(buffered), file), &leaf); aborted {
+		return true, nil
+	}
+	return false, x.limits.exceeded()
+}
+
+// extractZip extracts each of the files within the zip archive
+func (x *Extractor) extractZip(stage *ingest.Stage, guard *archiveGuard, parent *ingest.File, readerAt io.ReaderAt, size int64, container string, depth int) (bool, error) {
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return false, fmt.Errorf("Extract failed to open %s: %v", container, err)
+	}
+
+	// Check the whole archive before anything is extracted
+	paths := make([]string, len(archive.File))
+	for i, innerFile := range archive.File {
+		name, err := guard.sanitize(innerFile.Name)
+		if err != nil {
+			return false, err
+		}
+		paths[i] = virtualPath(container, name)
+		if err := guard.addEntry(paths[i], int64(innerFile.UncompressedSize64), int64(innerFile.CompressedSize64)); err != nil {
+			return false, err
+		}
+	}
+
+	for i, innerFile := range archive.File {
+		if innerFile.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := innerFile.Open()
+		if err != nil {
+			return false, fmt.Errorf("Extract failed to open %s: %v", paths[i], err)
+		}
+
+		compressed := int64(innerFile.CompressedSize64)
+		inner := ingest.NewFile(&entry{
+			Reader:  guard.limitRatio(rc, paths[i], func() int64 { return compressed }),
+			closers: []io.Closer{rc},
+		}, paths[i])
+		inner.Size = int64(innerFile.UncompressedSize64)
+		inner.ModTime = innerFile.FileInfo().ModTime()
+		inner.Parent = parent
+
+		if aborted, err := x.extract(stage, guard, inner, paths[i], depth+1); aborted || err != nil {
+			return aborted, err
+		}
+	}
+
+	return false, nil
+}
+
+// extractTar extracts each of the regular files within the tar archive
+func (x *Extractor) extractTar(stage *ingest.Stage, guard *archiveGuard, parent *ingest.File, reader io.Reader, container string, depth int) (bool, error) {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return false, nil
+		} else if exceeded := x.limits.exceeded(); exceeded != nil {
+			return false, exceeded
+		} else if err != nil {
+			return false, fmt.Errorf("Extract failed to read %s: %v", container, err)
+		}
+
+		name, err := guard.sanitize(header.Name)
+		if err != nil {
+			return false, err
+		}
+		innerPath := virtualPath(container, name)
+		if err := guard.addEntry(innerPath, header.Size, -1); err != nil {
+			return false, err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		inner := ingest.NewFile(ioutil.NopCloser(archive), innerPath)
+		inner.Size = header.Size
+		inner.ModTime = header.ModTime
+		inner.Parent = parent
+
+		if aborted, err := x.extract(stage, guard, inner, innerPath, depth+1); aborted || err != nil {
+			return aborted, err
+		}
+	}
+}
+
+// isZip checks whether head are the leading bytes of a zip archive
+func isZip(head []byte) bool {
+	for _, magic := range zipMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTar checks whether head is the header of a tar archive. Old archives without the ustar
+// magic are recognised by their extension
+func isTar(head []byte, name string) bool {
+	if len(head) >= tarMagicOffset+len(tarMagic) && bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic) {
+		return true
+	}
+	return strings.ToLower(filepath.Ext(name)) == ".tar"
+}
+
+// virtualPath joins the path of a file within an archive to the path of the archive
+func virtualPath(container string, name string) string {
+	if container == "" {
+		return name
+	}
+	return container + "/" + name
+}
@@ -0,0 +1,86 @@
+package process
+
+import (
+	"io"
+	"io/ioutil"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	Convey("Extract", t, func() {
+		out := make(chan interface{})
+		expected, _ := ioutil.ReadFile("../test/fixtures/csvtest/file1.csv")
+
+		readAll := func() map[string]string {
+			contents := map[string]string{}
+			for file := range out {
+				asCloser := file.(io.ReadCloser)
+				content, err := ioutil.ReadAll(asCloser)
+				So(err, ShouldBeNil)
+				asCloser.Close()
+
+				contents[file.(*ingest.File).Path] = string(content)
+			}
+			return contents
+		}
+
+		Convey("emits the files at the bottom of nested archives by their virtual path", func() {
+			err := ingest.Open("../test/fixtures/nested.zip").Then(Extract()).StreamTo(out).Build().RunAsync()
+			contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldResemble, map[string]string{
+				"../test/fixtures/nested.zip/inner.tar.gz/data/people.csv":      string(expected),
+				"../test/fixtures/nested.zip/inner.tar.gz/data/nested/more.csv": "name,age\nZed,40\n",
+				"../test/fixtures/nested.zip/readme.txt":                        "read me\n",
+				"../test/fixtures/nested.zip/deeper.zip/notes.txt":              "some notes\n",
+			})
+		})
+
+		Convey("is selectable by the virtual path", func() {
+			err := ingest.Open("../test/fixtures/nested.zip").
+				Then(Extract()).
+				Then(ingest.Select(`inner\.tar\.gz/data/.*\.csv$`)).
+				StreamTo(out).Build().RunAsync()
+			contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 2)
+			So(contents, ShouldContainKey, "../test/fixtures/nested.zip/inner.tar.gz/data/people.csv")
+		})
+
+		Convey("emits archives nested deeper than MaxDepth as they are", func() {
+			err := ingest.Open("../test/fixtures/nested.zip").Then(Extract(ExtractOpts{MaxDepth: 1})).StreamTo(out).Build().RunAsync()
+			contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 3)
+			So(contents, ShouldContainKey, "../test/fixtures/nested.zip/inner.tar.gz")
+			So(contents, ShouldContainKey, "../test/fixtures/nested.zip/deeper.zip")
+		})
+
+		Convey("descends into compressed tar archives", func() {
+			err := ingest.Open("../test/fixtures/example.tar.gz").
+				Then(Extract()).
+				Then(ingest.Select(`people\.csv$`)).
+				StreamTo(out).Build().RunAsync()
+			contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 1)
+			So(contents, ShouldContainKey, "../test/fixtures/example.tar.gz/data/people.csv")
+		})
+
+		Convey("emits files that aren't archives as they are", func() {
+			err := ingest.Open("../test/fixtures/csvtest/file1.csv").Then(Extract()).StreamTo(out).Build().RunAsync()
+			contents := readAll()
+
+			So(<-err, ShouldBeNil)
+			So(contents, ShouldResemble, map[string]string{"../test/fixtures/csvtest/file1.csv": string(expected)})
+		})
+	})
+}
@@ -0,0 +1,174 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// minRatioCheckSize is the number of bytes that must be extracted before MaxRatio is enforced,
+// since tiny files can have large ratios
+const minRatioCheckSize = 1 << 20
+
+type (
+	// limiter enforces the safety limits of an archive runner, remembering the first limit
+	// exceeded while the extracted files were being read
+	limiter struct {
+		runner     string
+		maxEntries int
+		maxBytes   int64
+		maxRatio   float64
+
+		mu  sync.Mutex
+		err error
+	}
+
+	// archiveGuard enforces the limits of a limiter for a single archive
+	archiveGuard struct {
+		*limiter
+		name    string
+		entries int
+
+		// total is the number of bytes extracted from the archive, updated atomically
+		total int64
+	}
+
+	// limitedReader is a reader that fails once the archive it belongs to exceeds its limits
+	limitedReader struct {
+		reader io.Reader
+		check  func(n int) error
+	}
+
+	// countingReader counts the bytes read through it
+	countingReader struct {
+		io.ReadCloser
+		count int64
+	}
+)
+
+// archive returns a guard for the next archive handled by the runner
+func (l *limiter) archive(name string) *archiveGuard {
+	return &archiveGuard{limiter: l, name: name}
+}
+
+// fail records the first limit that was exceeded and returns it
+func (l *limiter) fail(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+	return err
+}
+
+// exceeded returns the first limit that was exceeded, if any
+func (l *limiter) exceeded() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// reset returns the first limit that was exceeded, if any, and readies the limiter for the next job
+func (l *limiter) reset() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	l.err = nil
+	return err
+}
+
+// addEntry counts an entry of the archive, checking its declared size and compressed size
+// if known (ie. from a zip header). Sizes less than zero are unknown
+func (g *archiveGuard) addEntry(name string, size int64, compressed int64) error {
+	g.entries++
+	if g.maxEntries > 0 && g.entries > g.maxEntries {
+		return g.fail(fmt.Errorf("%s: %s has more than the MaxEntries of %d", g.runner, g.name, g.maxEntries))
+	}
+	if g.maxBytes > 0 && size > g.maxBytes {
+		return g.fail(fmt.Errorf("%s: %s in %s is larger than the MaxUncompressedBytes of %d", g.runner, name, g.name, g.maxBytes))
+	}
+	if compressed >= 0 && g.ratioExceeded(size, compressed) {
+		return g.fail(fmt.Errorf("%s: %s in %s is compressed by more than the MaxRatio of %v", g.runner, name, g.name, g.maxRatio))
+	}
+	return nil
+}
+
+// limitTotal counts the bytes read from reader towards the total extracted from the archive
+func (g *archiveGuard) limitTotal(reader io.Reader) io.Reader {
+	if g.maxBytes <= 0 {
+		return reader
+	}
+
+	return &limitedReader{reader: reader, check: func(n int) error {
+		if atomic.AddInt64(&g.total, int64(n)) > g.maxBytes {
+			return g.fail(fmt.Errorf("%s: %s is larger than the MaxUncompressedBytes of %d", g.runner, g.name, g.maxBytes))
+		}
+		return nil
+	}}
+}
+
+// limitRatio fails once more than MaxRatio times the bytes returned by compressed are read
+// from reader
+func (g *archiveGuard) limitRatio(reader io.Reader, name string, compressed func() int64) io.Reader {
+	if g.maxRatio <= 0 {
+		return reader
+	}
+
+	var read int64
+	return &limitedReader{reader: reader, check: func(n int) error {
+		read += int64(n)
+		if g.ratioExceeded(read, compressed()) {
+			return g.fail(fmt.Errorf("%s: %s in %s is compressed by more than the MaxRatio of %v", g.runner, name, g.name, g.maxRatio))
+		}
+		return nil
+	}}
+}
+
+func (g *archiveGuard) ratioExceeded(size int64, compressed int64) bool {
+	if g.maxRatio <= 0 || size < minRatioCheckSize {
+		return false
+	}
+	if compressed < 1 {
+		compressed = 1
+	}
+	return float64(size)/float64(compressed) > g.maxRatio
+}
+
+// Read implements io.Reader for limitedReader
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	if checkErr := l.check(n); checkErr != nil {
+		return n, checkErr
+	}
+	return n, err
+}
+
+// Read implements io.Reader for countingReader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read so far
+func (c *countingReader) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// sanitize cleans the name of a file within the archive, removing any leading slashes or drive
+// letters. It fails if the name would escape the directory it was extracted to (ie. ../etc/passwd)
+func (g *archiveGuard) sanitize(name string) (string, error) {
+	slashed := strings.Replace(name, `\`, "/", -1)
+	if len(slashed) >= 2 && slashed[1] == ':' {
+		slashed = slashed[2:]
+	}
+
+	cleaned := path.Clean(strings.TrimLeft(slashed, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", g.fail(fmt.Errorf("%s: %s has an entry with an unsafe path %q", g.runner, g.name, name))
+	}
+	return cleaned, nil
+}
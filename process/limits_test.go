@@ -0,0 +1,204 @@
+package process
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+
+	"testing"
+)
+
+// bombSize is large enough that MaxRatio is enforced
+const bombSize = 4 << 20
+
+func buildZip(files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for name, content := range files {
+		writer, _ := archive.Create(name)
+		writer.Write(content)
+	}
+	archive.Close()
+	return buf.Bytes()
+}
+
+func buildTarGz(files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		archive.Write(content)
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func buildGzip(content []byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write(content)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestArchiveLimits(t *testing.T) {
+	Convey("Archive limits", t, func() {
+		out := make(chan interface{})
+		in := make(chan interface{}, 1)
+		bomb := make([]byte, bombSize)
+
+		// run returns the names of the files emitted by the runner, and the error of the job. Limits
+		// exceeded while reading may not have failed the job by the time it is done, in which case
+		// the error returned by the reader is used
+		run := func(runner ingest.Runner, input []byte) ([]string, error) {
+			in <- bytes.NewReader(input)
+			close(in)
+
+			err := ingest.NewPipeline().
+				Then(ingest.NewInStream("In", in)).
+				Then(runner).
+				StreamTo(out).Build().RunAsync()
+
+			names := []string{}
+			var readErr error
+			for file := range out {
+				asCloser := file.(io.ReadCloser)
+				if _, err := ioutil.ReadAll(asCloser); err != nil && readErr == nil {
+					readErr = err
+				}
+				asCloser.Close()
+				names = append(names, file.(*ingest.File).Path)
+			}
+
+			if jobErr := <-err; jobErr != nil {
+				return names, jobErr
+			}
+			return names, readErr
+		}
+
+		Convey("Unzip", func() {
+			Convey("fails if there are more than MaxEntries", func() {
+				archive, _ := ioutil.ReadFile("../test/fixtures/example.zip")
+				_, err := run(Unzip(UnzipOpts{MaxEntries: 3}), archive)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxEntries of 3")
+			})
+
+			Convey("fails if a file is larger than MaxUncompressedBytes", func() {
+				_, err := run(Unzip(UnzipOpts{MaxUncompressedBytes: 1 << 20}), buildZip(map[string][]byte{"zeros": bomb}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxUncompressedBytes")
+			})
+
+			Convey("fails if a file is compressed by more than MaxRatio", func() {
+				_, err := run(Unzip(UnzipOpts{MaxRatio: 100}), buildZip(map[string][]byte{"zeros": bomb}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxRatio")
+			})
+
+			Convey("fails if the total of the files read is more than MaxUncompressedBytes", func() {
+				files := map[string][]byte{"a": bomb[:1<<20], "b": bomb[:1<<20]}
+				names, err := run(Unzip(UnzipOpts{MaxUncompressedBytes: 3 << 19}), buildZip(files))
+				So(names, ShouldHaveLength, 2)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxUncompressedBytes")
+			})
+
+			Convey("fails if a file escapes the archive", func() {
+				_, err := run(Unzip(), buildZip(map[string][]byte{"../../etc/passwd": []byte("root")}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unsafe path")
+			})
+
+			Convey("cleans the names of files", func() {
+				names, err := run(Unzip(), buildZip(map[string][]byte{"/data/./file.csv": []byte("a,b")}))
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"data/file.csv"})
+			})
+		})
+
+		Convey("Untar", func() {
+			Convey("fails if there are more than MaxEntries", func() {
+				files := map[string][]byte{"a": nil, "b": nil, "c": nil}
+				_, err := run(Untar(UntarOpts{MaxEntries: 2}), buildTarGz(files))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxEntries of 2")
+			})
+
+			Convey("fails if a file is larger than MaxUncompressedBytes", func() {
+				_, err := run(Untar(UntarOpts{MaxUncompressedBytes: 1 << 20}), buildTarGz(map[string][]byte{"zeros": bomb}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxUncompressedBytes")
+			})
+
+			Convey("fails if the archive is compressed by more than MaxRatio", func() {
+				_, err := run(Untar(UntarOpts{MaxRatio: 100}), buildTarGz(map[string][]byte{"zeros": bomb}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxRatio")
+			})
+
+			Convey("fails if a file escapes the archive", func() {
+				_, err := run(Untar(), buildTarGz(map[string][]byte{"data/../../evil.sh": []byte("#!/bin/sh")}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unsafe path")
+			})
+		})
+
+		Convey("Decompress", func() {
+			Convey("fails if a file is larger than MaxUncompressedBytes", func() {
+				_, err := run(Gunzip(DecompressOpts{MaxUncompressedBytes: 1 << 20}), buildGzip(bomb))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxUncompressedBytes")
+			})
+
+			Convey("fails if a file is compressed by more than MaxRatio", func() {
+				_, err := run(Decompress(DecompressOpts{MaxRatio: 100}), buildGzip(bomb))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxRatio")
+			})
+
+			Convey("allows files within the limits", func() {
+				_, err := run(Gunzip(DecompressOpts{MaxRatio: 100, MaxUncompressedBytes: 1 << 20}), buildGzip([]byte("a,b\n1,2\n")))
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("Extract", func() {
+			Convey("fails if nested archives have more than MaxEntries", func() {
+				archive, _ := ioutil.ReadFile("../test/fixtures/nested.zip")
+				_, err := run(Extract(ExtractOpts{MaxEntries: 5}), archive)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxEntries of 5")
+			})
+
+			Convey("fails if a nested archive is compressed by more than MaxRatio", func() {
+				nested := buildZip(map[string][]byte{"inner.tar.gz": buildTarGz(map[string][]byte{"zeros": bomb})})
+				_, err := run(Extract(ExtractOpts{MaxRatio: 100}), nested)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxRatio")
+			})
+
+			Convey("fails if more than MaxUncompressedBytes are extracted", func() {
+				nested := buildZip(map[string][]byte{"inner.gz": buildGzip(bomb)})
+				_, err := run(Extract(ExtractOpts{MaxUncompressedBytes: 1 << 20}), nested)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxUncompressedBytes")
+			})
+
+			Convey("fails if a nested file escapes its archive", func() {
+				nested := buildZip(map[string][]byte{"inner.tar.gz": buildTarGz(map[string][]byte{"../evil.sh": nil})})
+				_, err := run(Extract(), nested)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unsafe path")
+			})
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// spooler provides random access to archive inputs, copying those that can only be read
+	// sequentially to temporary files in a directory owned by the current job
+	spooler struct {
+		tempDir string
+		maxSize int64
+
+		// dir holds the spooled copies of inputs for the current job
+		dir string
+		mu  sync.Mutex
+	}
+
+	// spoolFile is a spooled copy of an input, which is removed when it is closed
+	spoolFile struct {
+		*os.File
+	}
+
+	// sizedReaderAt is an io.ReaderAt which knows its size, ie. *bytes.Reader
+	sizedReaderAt interface {
+		io.ReaderAt
+		Size() int64
+	}
+)
+
+// randomAccess returns the input as an io.ReaderAt along with its size, if it can be read at random
+// without spooling it
+func randomAccess(input interface{}) (io.ReaderAt, int64, bool) {
+	switch in := input.(type) {
+	case *ingest.File:
+		return randomAccess(in.ReadCloser)
+	case sizedReaderAt:
+		return in, in.Size(), true
+	case *os.File:
+		if info, err := in.Stat(); err == nil && info.Mode().IsRegular() {
+			return in, info.Size(), true
+		}
+	case io.ReadSeeker:
+		if readerAt, isReaderAt := in.(io.ReaderAt); isReaderAt {
+			if size, err := in.Seek(0, io.SeekEnd); err == nil {
+				return readerAt, size, true
+			}
+		}
+	case string:
+		return bytes.NewReader([]byte(in)), int64(len(in)), true
+	case []byte:
+		return bytes.NewReader(in), int64(len(in)), true
+	}
+	return nil, 0, false
+}
+
+// readerAt returns the input as an io.ReaderAt along with its size, spooling it if needed.
+//
+// If the input was spooled the spoolFile is returned as the io.ReaderAt, and must be closed
+func (s *spooler) readerAt(input interface{}) (io.ReaderAt, int64, error) {
+	if readerAt, size, ok := randomAccess(input); ok {
+		return readerAt, size, nil
+	}
+
+	reader, err := utils.ToIOReader(input)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.spool(reader)
+}
+
+// spool copies the reader to a new temporary file, which must be closed
+func (s *spooler) spool(reader io.Reader) (*spoolFile, int64, error) {
+	dir, err := s.ensureDir()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	file, err := ioutil.TempFile(dir, "spool-")
+	if err != nil {
+		return nil, 0, err
+	}
+	spooled := &spoolFile{file}
+
+	size, err := io.Copy(file, io.LimitReader(reader, s.maxSize+1))
+	if err == nil && size > s.maxSize {
+		err = fmt.Errorf("archive is larger than the MaxSpoolSize of %d bytes", s.maxSize)
+	}
+	if err != nil {
+		spooled.Close()
+		return nil, 0, err
+	}
+
+	return spooled, size, nil
+}
+
+// ensureDir creates the spool directory for the current job if needed
+func (s *spooler) ensureDir() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		if err := os.MkdirAll(s.tempDir, 0755); err != nil {
+			return "", err
+		}
+		dir, err := ioutil.TempDir(s.tempDir, "ingest-spool-")
+		if err != nil {
+			return "", err
+		}
+		s.dir = dir
+	}
+	return s.dir, nil
+}
+
+// cleanup removes the spool directory along with anything left in it, readying the
+// spooler for the next job
+func (s *spooler) cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	return err
+}
+
+// Close closes and removes the spooled file
+func (s *spoolFile) Close() error {
+	err := s.File.Close()
+	if removeErr := os.Remove(s.File.Name()); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package process
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// Untarrer is a Runner that will extract the files from tar archives
+	Untarrer struct {
+		filter []*regexp.Regexp
+		logger ingest.Logger
+		limits *limiter
+	}
+
+	// UntarOpts are options used to configure an Untarrer
+	UntarOpts struct {
+		// MaxEntries is the most entries an archive may have. Defaults to no limit
+		MaxEntries int
+
+		// MaxUncompressedBytes is the most bytes that may be extracted from each archive.
+		// Defaults to no limit
+		MaxUncompressedBytes int64
+
+		// MaxRatio is the largest ratio of uncompressed to compressed size allowed for compressed
+		// archives, which is enforced once 1MB has been extracted. Defaults to no limit
+		MaxRatio float64
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+)
+
+// Untar receives tar archives (which may be compressed with gzip, bzip2 or xz) and streams
+// the regular files within them as an *ingest.File whose Parent is the archive, without needing
+// a temporary directory. Directories, links and other special files are skipped.
+//
+// Each file must be read to the end or closed before the next is emitted. The names of the files
+// are cleaned of leading slashes, and archives with names that escape the archive (ie. ../etc/passwd)
+// or exceed the limits set in opts will fail the job.
+//
+// It is selectable, allowing you to use a Regex to filter said files
+func Untar(opts ...UntarOpts) *Untarrer {
+	opt := defaultUntarOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	return &Untarrer{
+		logger: opt.Logger.WithField("processor", "untar"),
+		limits: &limiter{
+			runner:     "Untar",
+			maxEntries: opt.MaxEntries,
+			maxBytes:   opt.MaxUncompressedBytes,
+			maxRatio:   opt.MaxRatio,
+		},
+	}
+}
+
+func defaultUntarOpts() UntarOpts {
+	return UntarOpts{
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// Name implements ingest.Runner for Untarrer
+func (u *Untarrer) Name() string {
+	return "Untar"
+}
+
+// Run implements ingest.Runner for Untarrer
+func (u *Untarrer) Run(stage *ingest.Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case input, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+
+			rc, err := utils.ToIOReadCloser(input)
+			if err != nil {
+				return err
+			}
+			if aborted, err := u.handleArchive(stage, rc, ingest.FileOf(input)); aborted || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SetSelection implements ingest.Selectable for Untarrer
+//
+// It will filter the contents of the extracted files for file names that match
+// the regex provided by the selection
+func (u *Untarrer) SetSelection(selections ...string) {
+	for _, selection := range selections {
+		u.filter = append(u.filter, regexp.MustCompile(selection))
+	}
+}
+
+// OnPipelineDone implements ingest.OnDone for Untarrer, failing if a limit was exceeded
+// while the files were being read
+func (u *Untarrer) OnPipelineDone() error {
+	return u.limits.reset()
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (u *Untarrer) SkipAbortErr() bool {
+	return true
+}
+
+// handleArchive emits the matching files of the archive one at a time
+//
+// It returns true if the stage was aborted
+func (u *Untarrer) handleArchive(stage *ingest.Stage, rc io.ReadCloser, parent *ingest.File) (bool, error) {
+	name := ingest.PathOf(parent)
+
+	// Transparently handle .tar.gz and friends
+	compressed := &countingReader{ReadCloser: rc}
+	decompressed, err := decompress(compressed, "", "")
+	if err != nil {
+		rc.Close()
+		return false, err
+	}
+	defer decompressed.Close()
+
+	guard := u.limits.archive(name)
+	archive := tar.NewReader(guard.limitRatio(decompressed, name, compressed.Count))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return false, nil
+		} else if exceeded := u.limits.exceeded(); exceeded != nil {
+			return false, exceeded
+		} else if err != nil {
+			return false, fmt.Errorf("Untar failed to read archive: %v", err)
+		}
+
+		entryName, err := guard.sanitize(header.Name)
+		if err != nil {
+			return false, err
+		}
+		if err := guard.addEntry(entryName, header.Size, -1); err != nil {
+			return false, err
+		}
+
+		log := u.logger.WithField("file", entryName)
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			log.Debug("skipping non-regular file")
+			continue
+		}
+		if !filterMatch(u.filter, entryName) {
+			continue
+		}
+
+		log.Debug("found match")
+		file := ingest.NewFile(nil, entryName)
+		file.Size = header.Size
+		file.ModTime = header.ModTime
+		file.Parent = parent
+
+		if aborted := emitHeld(stage, newHeldEntry(guard.limitTotal(archive)), file); aborted {
+			return true, nil
+		}
+		if err := u.limits.exceeded(); err != nil {
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package process
+
+import (
+	"io"
+	"io/ioutil"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/parse"
+
+	"testing"
+)
+
+func TestUntar(t *testing.T) {
+	Convey("Untar", t, func() {
+		out := make(chan interface{})
+		names := []string{}
+
+		readAll := func() {
+			for file := range out {
+				asCloser := file.(io.ReadCloser)
+				_, err := ioutil.ReadAll(asCloser)
+				So(err, ShouldBeNil)
+				asCloser.Close()
+				names = append(names, file.(*ingest.File).Path)
+			}
+		}
+
+		Convey("emits the regular files in the archive", func() {
+			err := ingest.Open("../test/fixtures/example.tar.gz").Then(Untar()).StreamTo(out).Build().RunAsync()
+			readAll()
+
+			So(<-err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"data/nested/more.csv", "data/people.csv", "readme.txt"})
+		})
+
+		Convey("is selectable", func() {
+			err := ingest.Open("../test/fixtures/example.tar.gz").
+				Then(Untar()).
+				Then(ingest.Select(`\.csv$`)).
+				StreamTo(out).Build().RunAsync()
+			readAll()
+
+			So(<-err, ShouldBeNil)
+			So(names, ShouldHaveLength, 2)
+		})
+
+		Convey("moves on to the next file when an entry is closed unread", func() {
+			err := ingest.Open("../test/fixtures/example.tar.gz").Then(Untar()).StreamTo(out).Build().RunAsync()
+			count := 0
+			for file := range out {
+				file.(io.Closer).Close()
+				count++
+			}
+
+			So(<-err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("can be consumed by parsers", func() {
+			type Person struct {
+				Name string `csv:"name"`
+				Age  int    `csv:"age"`
+			}
+
+			err := ingest.Open("../test/fixtures/example.tar.gz").
+				Then(Untar()).
+				Then(ingest.Select(`\.csv$`)).
+				Then(parse.CSV(Person{})).
+				StreamTo(out).Build().RunAsync()
+
+			results := []interface{}{}
+			for rec := range out {
+				results = append(results, rec)
+			}
+
+			So(<-err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{Person{Name: "Alice", Age: 26}, Person{Name: "Bob", Age: 31}})
+		})
+	})
+}
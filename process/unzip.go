@@ -2,25 +2,120 @@ package process
 
 import (
 	"archive/zip"
-	"errors"
+	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"sync"
 
 	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
 )
 
-// Unzipper is a Runner that will unzip a file
-type Unzipper struct {
-	filter []*regexp.Regexp
-	logger ingest.Logger
-}
+type (
+	// Unzipper is a Runner that will unzip a file
+	Unzipper struct {
+		filter []*regexp.Regexp
+		logger ingest.Logger
+		opts   *UnzipOpts
+
+		// spool provides random access to the archives, which are closed once the
+		// pipeline is done since the emitted files read from them
+		spool  *spooler
+		limits *limiter
+
+		// opened are the archives of the last run, which are closed once the pipeline is done
+		opened *openArchives
+	}
+
+	// UnzipOpts are options used to configure an Unzipper
+	UnzipOpts struct {
+		// TempDir is the directory in which inputs that can't be read at random are spooled.
+		// Defaults to the system temp directory
+		TempDir string
+
+		// MaxSpoolSize is the largest input, in bytes, that will be spooled. Defaults to 4GB
+		MaxSpoolSize int64
+
+		// MaxEntries is the most entries an archive may have. Defaults to no limit
+		MaxEntries int
+
+		// MaxUncompressedBytes is the most bytes that may be extracted from each archive.
+		// Defaults to no limit
+		MaxUncompressedBytes int64
+
+		// MaxRatio is the largest ratio of uncompressed to compressed size allowed for each file
+		// in an archive, which is enforced once 1MB of the file has been extracted. Defaults to no limit
+		MaxRatio float64
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
 
-// Unzip receives an os.File and will Unzip it, emitting the files within
+	// zipArchive is an archive being unzipped, which is kept open until the entries emitted
+	// from it are all released
+	zipArchive struct {
+		name    string
+		file    *ingest.File
+		reader  *zip.Reader
+		closers []io.Closer
+
+		mu       sync.Mutex
+		entries  []*heldEntry
+		held     int
+		emitting bool
+		closed   chan bool
+	}
+
+	// openArchives are the archives opened by a run of the Unzipper
+	openArchives struct {
+		mu       sync.Mutex
+		archives []*zipArchive
+	}
+)
+
+// Unzip receives zip archives and will Unzip them, emitting the files within as an *ingest.File
+// whose Parent is the archive
+//
+// Archives may be an *os.File, anything implementing io.ReaderAt with a Size() method
+// (ie. *bytes.Reader), a string or a []byte. Any other io.Reader is spooled to a temporary file.
+//
+// Each archive is kept open until the files emitted from it are read to the end or closed. Any
+// still open once the pipeline is done, or when the stage is aborted, are closed then, so files
+// emitted out of the pipeline must be read before the job finishes.
+//
+// The progress of each archive is reported to Job.OnProgress as the bytes of the selected files
+// are read, out of their total uncompressed size.
+//
+// The names of the files are cleaned of leading slashes, and archives with names that escape
+// the archive (ie. ../etc/passwd) or exceed the limits set in opts will fail the job.
 //
 // It is selectable, allowing you to use a Regex to filter said files
-func Unzip() *Unzipper {
+func Unzip(opts ...UnzipOpts) *Unzipper {
+	opt := defaultUnzipOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
 	return &Unzipper{
-		logger: ingest.DefaultLogger.WithField("processor", "unzip"),
+		logger: opt.Logger.WithField("processor", "unzip"),
+		opts:   &opt,
+		spool:  &spooler{tempDir: opt.TempDir, maxSize: opt.MaxSpoolSize},
+		opened: &openArchives{},
+		limits: &limiter{
+			runner:     "Unzip",
+			maxEntries: opt.MaxEntries,
+			maxBytes:   opt.MaxUncompressedBytes,
+			maxRatio:   opt.MaxRatio,
+		},
+	}
+}
+
+func defaultUnzipOpts() UnzipOpts {
+	return UnzipOpts{
+		TempDir:      os.TempDir(),
+		MaxSpoolSize: 4 << 30,
+		Logger:       ingest.DefaultLogger,
 	}
 }
 
@@ -30,57 +125,46 @@ func (u *Unzipper) Name() string {
 }
 
 // Run implements ingest.Runner for Unzipper
+//
+// It finishes once its input is closed, without waiting for the files it emitted to be read
 func (u *Unzipper) Run(stage *ingest.Stage) error {
-	log := u.logger
 	for {
 		select {
 		case <-stage.Abort:
+			u.opened.closeAll()
 			return nil
-		case in, ok := <-stage.In:
+		case input, ok := <-stage.In:
 			if !ok {
-				return nil
-			}
-			file, isFile := in.(*os.File)
-			if !isFile {
-				return errors.New("Unzip received non *os.File input")
+				return u.limits.exceeded()
 			}
-			file.Close() // we don't need it open anymore, we are going to re-open it as a zip
 
-			log.WithField("file", file.Name()).Debug("opening")
-			archive, err := zip.OpenReader(file.Name())
+			archive, err := u.openArchive(input)
 			if err != nil {
+				u.opened.closeAll()
 				return err
 			}
+			u.opened.add(archive)
 
-			for _, innerFile := range archive.File {
-				if u.filterMatch(innerFile.FileHeader.Name) {
-					log.WithField("file", innerFile.FileHeader.Name).Debug("found match")
-					osFile, err := innerFile.Open()
-					if err != nil {
-						return err
-					}
-					select {
-					case <-stage.Abort:
-						return nil
-					case stage.Out <- osFile:
-					}
-				}
+			if aborted, err := u.emitEntries(stage, archive); aborted || err != nil {
+				u.opened.closeAll()
+				return err
 			}
 		}
 	}
-	return nil
 }
 
-// OnAdd implements ingest.OnAdd for Unzipper
+// OnPipelineDone implements ingest.OnDone for Unzipper
 //
-// It will configure the ingest.Opener to have a tmp Directory (needed since zips need random access)
-// If it is not already configured to do so.
-func (u *Unzipper) OnAdd(prevRunner ingest.Runner) {
-	if opener, isOpener := prevRunner.(*ingest.Opener); isOpener {
-		if opener.Opts.TempDir == "" {
-			opener.Opts.TempDir = "tmp/"
-		}
+// It closes the archives and any files emitted from them that haven't been released, and removes
+// the directory inputs were spooled to. It fails if a limit was exceeded while the files were
+// being read
+func (u *Unzipper) OnPipelineDone() error {
+	u.opened.closeAll()
+	exceeded := u.limits.reset()
+	if err := u.spool.cleanup(); err != nil && exceeded == nil {
+		return err
 	}
+	return exceeded
 }
 
 // SetSelection implements ingest.Selectable for Unzipper
@@ -98,16 +182,182 @@ func (u *Unzipper) SkipAbortErr() bool {
 	return true
 }
 
-func (u *Unzipper) filterMatch(name string) bool {
-	if len(u.filter) == 0 {
-		return true
+// openArchive opens the input as a zip archive, spooling it to disk if it can't be read at random
+func (u *Unzipper) openArchive(input interface{}) (*zipArchive, error) {
+	archive := &zipArchive{
+		name:     ingest.PathOf(input),
+		file:     ingest.FileOf(input),
+		emitting: true,
+		closed:   make(chan bool),
+	}
+	u.logger.WithField("file", archive.name).Debug("opening")
+
+	if closer, isCloser := input.(io.Closer); isCloser {
+		archive.closers = append(archive.closers, closer)
+	}
+
+	readerAt, size, err := u.spool.readerAt(input)
+	if err != nil {
+		archive.close()
+		return nil, fmt.Errorf("Unzip failed to open %s: %v", archive.name, err)
+	}
+	if spooled, isSpooled := readerAt.(*spoolFile); isSpooled {
+		archive.closers = append(archive.closers, spooled)
+	}
+
+	if archive.reader, err = zip.NewReader(readerAt, size); err != nil {
+		archive.close()
+		return nil, fmt.Errorf("Unzip failed to open %s: %v", archive.name, err)
+	}
+	return archive, nil
+}
+
+// emitEntries emits the matching files of the archive, which is closed once they are all released
+//
+// It returns true if the stage was aborted
+func (u *Unzipper) emitEntries(stage *ingest.Stage, archive *zipArchive) (bool, error) {
+	defer archive.doneEmitting()
+
+	// Check the whole archive before anything is emitted
+	guard := u.limits.archive(archive.name)
+	names := make([]string, len(archive.reader.File))
+	for i, innerFile := range archive.reader.File {
+		var err error
+		if names[i], err = guard.sanitize(innerFile.Name); err != nil {
+			return false, err
+		}
+		if err := guard.addEntry(names[i], int64(innerFile.UncompressedSize64), int64(innerFile.CompressedSize64)); err != nil {
+			return false, err
+		}
+	}
+
+	var selectedBytes int64
+	for i, innerFile := range archive.reader.File {
+		if filterMatch(u.filter, names[i]) {
+			selectedBytes += int64(innerFile.UncompressedSize64)
+		}
+	}
+	progress := stage.TrackProgress(archive.name, selectedBytes)
+
+	for i, innerFile := range archive.reader.File {
+		if !filterMatch(u.filter, names[i]) {
+			continue
+		}
+
+		u.logger.WithField("file", names[i]).Debug("found match")
+		rc, err := innerFile.Open()
+		if err != nil {
+			return false, err
+		}
+
+		compressed := int64(innerFile.CompressedSize64)
+		reader := progress.Reader(guard.limitTotal(guard.limitRatio(rc, names[i], func() int64 { return compressed })))
+		held := archive.hold(newHeldEntry(reader, rc))
+
+		file := ingest.NewFile(held, names[i])
+		file.Size = int64(innerFile.UncompressedSize64)
+		file.ModTime = innerFile.FileInfo().ModTime()
+		file.Parent = archive.file
+
+		select {
+		case <-stage.Abort:
+			held.Close()
+			return true, nil
+		case stage.Out <- file:
+			progress.AddRecords(1)
+		}
+	}
+
+	return false, nil
+}
+
+// hold tracks an entry emitted from the archive, keeping the archive open until it is released
+func (z *zipArchive) hold(held *heldEntry) *heldEntry {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.entries = append(z.entries, held)
+	z.held++
+	held.onRelease = z.entryReleased
+	return held
+}
+
+// entryReleased closes the archive once its last entry is released
+func (z *zipArchive) entryReleased() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.held--
+	if z.held == 0 && !z.emitting {
+		z.closeLocked()
+	}
+}
+
+// doneEmitting closes the archive if all of its entries have already been released
+func (z *zipArchive) doneEmitting() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.emitting = false
+	if z.held == 0 {
+		z.closeLocked()
 	}
+}
+
+// close closes any entries that haven't been released, and then the archive
+func (z *zipArchive) close() {
+	z.mu.Lock()
+	z.emitting = false
+	entries := z.entries
+	z.mu.Unlock()
+
+	// Entries are closed without holding the lock, since releasing them takes it
+	for _, held := range entries {
+		held.Close()
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.closeLocked()
+}
 
-	for _, regex := range u.filter {
-		if regex.MatchString(name) {
-			return true
+func (z *zipArchive) closeLocked() {
+	select {
+	case <-z.closed:
+		return
+	default:
+	}
+
+	for _, closer := range z.closers {
+		closer.Close()
+	}
+	close(z.closed)
+}
+
+// add tracks an archive, forgetting those that have already been closed
+func (o *openArchives) add(archive *zipArchive) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	open := o.archives[:0]
+	for _, existing := range o.archives {
+		select {
+		case <-existing.closed:
+		default:
+			open = append(open, existing)
 		}
 	}
+	o.archives = append(open, archive)
+}
 
-	return false
+// closeAll closes every archive along with their entries, and forgets them
+func (o *openArchives) closeAll() {
+	o.mu.Lock()
+	archives := o.archives
+	o.archives = nil
+	o.mu.Unlock()
+
+	for _, archive := range archives {
+		archive.close()
+	}
 }
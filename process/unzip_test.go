@@ -4,10 +4,24 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/urbint/ingest"
 
+	"bytes"
 	"io"
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
+// openFileDescriptors returns the number of files open by the process, or -1 if unknown
+func openFileDescriptors() int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(fds)
+}
+
 func TestUnzip(t *testing.T) {
 	Convey("Unzip", t, func() {
 		out := make(chan interface{})
@@ -25,6 +39,53 @@ func TestUnzip(t *testing.T) {
 			So(results, ShouldHaveLength, 4)
 		})
 
+		Convey("finishes without waiting for the files to be read", func() {
+			err := ingest.Open("../test/fixtures/nested.zip").Then(Unzip()).StreamTo(out).Build().RunAsync()
+			for file := range out {
+				results = append(results, file)
+			}
+
+			select {
+			case err := <-err:
+				So(err, ShouldBeNil)
+			case <-time.After(5 * time.Second):
+				So("the job to finish", ShouldBeNil)
+			}
+
+			Convey("closing the files left unread once the pipeline is done", func() {
+				So(results, ShouldHaveLength, 3)
+				for _, file := range results {
+					content, readErr := ioutil.ReadAll(file.(io.Reader))
+					So(readErr, ShouldBeNil)
+					So(content, ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("reports its progress", func() {
+			var mu sync.Mutex
+			var last ingest.Progress
+			err := ingest.Open("../test/fixtures/nested.zip").Then(Unzip()).StreamTo(out).Build().
+				OnProgress(func(progress ingest.Progress) {
+					mu.Lock()
+					defer mu.Unlock()
+					if progress.Stage == "Unzip" {
+						last = progress
+					}
+				}).RunAsync()
+			for file := range out {
+				ioutil.ReadAll(file.(io.Reader))
+				file.(io.Closer).Close()
+			}
+
+			So(<-err, ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(last, ShouldResemble, ingest.Progress{
+				Stage: "Unzip", File: "../test/fixtures/nested.zip", BytesDone: 408, BytesTotal: 408, RecordsEmitted: 3,
+			})
+		})
+
 		Convey("is selectable", func() {
 			err := ingest.Open("../test/fixtures/example.zip").
 				Then(Unzip()).
@@ -40,5 +101,109 @@ func TestUnzip(t *testing.T) {
 			So(<-err, ShouldBeNil)
 			So(results, ShouldHaveLength, 2)
 		})
+
+		Convey("accepts archives without a temp directory", func() {
+			archive, _ := ioutil.ReadFile("../test/fixtures/example.zip")
+			in := make(chan interface{}, 1)
+
+			readAll := func(unzip *Unzipper) error {
+				err := ingest.NewPipeline().
+					Then(ingest.NewInStream("In", in)).
+					Then(unzip).
+					StreamTo(out).Build().RunAsync()
+
+				for file := range out {
+					asCloser := file.(io.ReadCloser)
+					_, readErr := ioutil.ReadAll(asCloser)
+					So(readErr, ShouldBeNil)
+					asCloser.Close()
+					results = append(results, asCloser)
+				}
+				return <-err
+			}
+
+			Convey("from in-memory buffers", func() {
+				in <- bytes.NewReader(archive)
+				close(in)
+
+				So(readAll(Unzip()), ShouldBeNil)
+				So(results, ShouldHaveLength, 4)
+			})
+
+			Convey("spooling readers that can't be read at random", func() {
+				tempDir, _ := ioutil.TempDir("", "unzip-test-")
+				defer os.RemoveAll(tempDir)
+
+				in <- ioutil.NopCloser(bytes.NewBuffer(archive))
+				close(in)
+
+				So(readAll(Unzip(UnzipOpts{TempDir: tempDir})), ShouldBeNil)
+				So(results, ShouldHaveLength, 4)
+
+				Convey("and removes the spool once the pipeline is done", func() {
+					spooled, _ := ioutil.ReadDir(tempDir)
+					So(spooled, ShouldBeEmpty)
+				})
+			})
+
+			Convey("failing if the spool would be larger than MaxSpoolSize", func() {
+				in <- ioutil.NopCloser(bytes.NewBuffer(archive))
+				close(in)
+
+				err := readAll(Unzip(UnzipOpts{MaxSpoolSize: 16}))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MaxSpoolSize")
+			})
+		})
+
+		Convey("doesn't leak file descriptors", func() {
+			before := openFileDescriptors()
+			if before == -1 {
+				SkipSo(before, ShouldBeGreaterThan, 0)
+				return
+			}
+
+			Convey("when the files are read or closed", func() {
+				for i := 0; i < 20; i++ {
+					stream := make(chan interface{})
+					err := ingest.Open("../test/fixtures/example.zip").Then(Unzip()).StreamTo(stream).Build().RunAsync()
+					read := false
+					for file := range stream {
+						// Alternate between reading files to the end and closing them unread
+						if read {
+							ioutil.ReadAll(file.(io.Reader))
+						} else {
+							file.(io.Closer).Close()
+						}
+						read = !read
+					}
+					So(<-err, ShouldBeNil)
+				}
+
+				So(openFileDescriptors(), ShouldBeLessThanOrEqualTo, before)
+			})
+
+			Convey("when the job is aborted", func() {
+				for i := 0; i < 5; i++ {
+					// The input stream is left open so that every stage is running when aborted
+					archives := make(chan interface{}, 1)
+					archive, _ := os.Open("../test/fixtures/example.zip")
+					archives <- archive
+
+					stream := make(chan interface{})
+					job := ingest.NewPipeline().
+						Then(ingest.NewInStream("In", archives)).
+						Then(Unzip()).
+						StreamTo(stream).Build().Start()
+
+					<-stream // Left unread and open
+					for range job.Abort() {
+					}
+					job.Wait()
+				}
+
+				So(openFileDescriptors(), ShouldBeLessThanOrEqualTo, before)
+			})
+		})
 	})
 }
@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Progress describes how far a stage of a Job has got through a file
+	Progress struct {
+		// Stage is the name of the Runner reporting the progress
+		Stage string
+
+		// File is the path of the file
+		File string
+
+		// BytesDone is how many bytes of the file have been read
+		BytesDone int64
+
+		// BytesTotal is the size of the file in bytes, or -1 if it is unknown
+		BytesTotal int64
+
+		// RecordsEmitted is how many records (or files) the stage has emitted from the file
+		RecordsEmitted int64
+	}
+
+	// A ProgressFn receives the Progress of a Job
+	ProgressFn func(progress Progress)
+
+	// ProgressOpts are used to configure how Progress is delivered
+	ProgressOpts struct {
+		// Interval is the shortest time between two Progress events for the same file of a stage.
+		// Events reported in between are coalesced into the latest. Defaults to 500ms
+		Interval time.Duration
+	}
+
+	// A ProgressTracker counts the bytes read from and records emitted from a file by a stage,
+	// reporting them to the Job. It is safe to use from multiple goroutines
+	ProgressTracker struct {
+		stage          *Stage
+		file           string
+		bytesTotal     int64
+		bytesDone      int64
+		recordsEmitted int64
+	}
+
+	// progressReporter delivers the Progress of a Job to a ProgressFn from its own goroutine, so
+	// that a slow ProgressFn never blocks the pipeline
+	progressReporter struct {
+		fn       ProgressFn
+		interval time.Duration
+
+		mu      sync.Mutex
+		pending map[progressKey]Progress
+		order   []progressKey
+		stopped bool
+
+		stop chan bool
+		done chan bool
+	}
+
+	progressKey struct {
+		stage string
+		file  string
+	}
+
+	// progressReader counts the bytes read through it
+	progressReader struct {
+		io.Reader
+		tracker *ProgressTracker
+	}
+)
+
+func defaultProgressOpts() ProgressOpts {
+	return ProgressOpts{Interval: 500 * time.Millisecond}
+}
+
+// ReportProgress reports the progress of the stage to the Job. It never blocks, and does nothing
+// unless the Job was configured with OnProgress
+func (s *Stage) ReportProgress(progress Progress) {
+	if s == nil || s.progress == nil {
+		return
+	}
+	if progress.Stage == "" {
+		progress.Stage = s.runner
+	}
+	s.progress.report(progress)
+}
+
+// TrackProgress builds a ProgressTracker for a file of bytesTotal bytes (or -1 if it is unknown)
+func (s *Stage) TrackProgress(file string, bytesTotal int64) *ProgressTracker {
+	return &ProgressTracker{stage: s, file: file, bytesTotal: bytesTotal}
+}
+
+// AddBytes counts bytes read from the file
+func (t *ProgressTracker) AddBytes(n int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.bytesDone, n)
+	t.report()
+}
+
+// AddRecords counts records emitted from the file
+func (t *ProgressTracker) AddRecords(n int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.recordsEmitted, n)
+	t.report()
+}
+
+// Reader counts the bytes read through reader
+func (t *ProgressTracker) Reader(reader io.Reader) io.Reader {
+	if t == nil || t.stage.progress == nil {
+		return reader
+	}
+	return &progressReader{Reader: reader, tracker: t}
+}
+
+// ReadCloser counts the bytes read through rc
+func (t *ProgressTracker) ReadCloser(rc io.ReadCloser) io.ReadCloser {
+	if t == nil || t.stage.progress == nil {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{t.Reader(rc), rc}
+}
+
+func (t *ProgressTracker) report() {
+	t.stage.ReportProgress(Progress{
+		File:           t.file,
+		BytesDone:      atomic.LoadInt64(&t.bytesDone),
+		BytesTotal:     t.bytesTotal,
+		RecordsEmitted: atomic.LoadInt64(&t.recordsEmitted),
+	})
+}
+
+// Read implements io.Reader for progressReader
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.Reader.Read(buf)
+	if n > 0 {
+		p.tracker.AddBytes(int64(n))
+	}
+	return n, err
+}
+
+// newProgressReporter starts delivering Progress to fn
+func newProgressReporter(fn ProgressFn, interval time.Duration) *progressReporter {
+	reporter := &progressReporter{
+		fn:       fn,
+		interval: interval,
+		pending:  map[progressKey]Progress{},
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+	go reporter.deliver()
+	return reporter
+}
+
+// report queues the progress to be delivered, replacing any progress for the same file of
+// the same stage which hasn't been delivered yet
+func (r *progressReporter) report(progress Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+	key := progressKey{stage: progress.Stage, file: progress.File}
+	if _, isPending := r.pending[key]; !isPending {
+		r.order = append(r.order, key)
+	}
+	r.pending[key] = progress
+}
+
+// deliver calls fn with the pending Progress once per interval until the reporter is closed
+func (r *progressReporter) deliver() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.stop:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush calls fn with the pending Progress in the order it was first reported
+func (r *progressReporter) flush() {
+	r.mu.Lock()
+	pending, order := r.pending, r.order
+	r.pending, r.order = map[progressKey]Progress{}, nil
+	r.mu.Unlock()
+
+	for _, key := range order {
+		r.fn(pending[key])
+	}
+}
+
+// close delivers the remaining Progress and stops the reporter. Progress reported after it is closed
+// is dropped
+func (r *progressReporter) close() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// progressLog collects the Progress delivered to it
+type progressLog struct {
+	mu     sync.Mutex
+	events []Progress
+}
+
+func (p *progressLog) add(progress Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, progress)
+}
+
+// last returns the last Progress delivered for the stage and file
+func (p *progressLog) last(stage string, file string) (Progress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.events) - 1; i >= 0; i-- {
+		if p.events[i].Stage == stage && p.events[i].File == file {
+			return p.events[i], true
+		}
+	}
+	return Progress{}, false
+}
+
+func TestProgress(t *testing.T) {
+	Convey("Progress", t, func() {
+		log := &progressLog{}
+
+		Convey("is coalesced into the latest for each file", func() {
+			reporter := newProgressReporter(log.add, time.Hour)
+			for i := int64(1); i <= 100; i++ {
+				reporter.report(Progress{Stage: "CSV", File: "a.csv", BytesDone: i})
+			}
+			reporter.report(Progress{Stage: "CSV", File: "b.csv", BytesDone: 1})
+			reporter.close()
+
+			So(log.events, ShouldResemble, []Progress{
+				{Stage: "CSV", File: "a.csv", BytesDone: 100},
+				{Stage: "CSV", File: "b.csv", BytesDone: 1},
+			})
+		})
+
+		Convey("is delivered once per interval", func() {
+			reporter := newProgressReporter(log.add, 10*time.Millisecond)
+			reporter.report(Progress{File: "a.csv", BytesDone: 1})
+			time.Sleep(50 * time.Millisecond)
+			reporter.report(Progress{File: "a.csv", BytesDone: 2})
+			reporter.close()
+
+			So(log.events, ShouldHaveLength, 2)
+		})
+
+		Convey("never blocks on a slow ProgressFn", func() {
+			reporter := newProgressReporter(func(Progress) { time.Sleep(100 * time.Millisecond) }, time.Millisecond)
+			started := time.Now()
+			for i := int64(0); i < 1000; i++ {
+				reporter.report(Progress{File: "a.csv", BytesDone: i})
+			}
+			So(time.Since(started), ShouldBeLessThan, 50*time.Millisecond)
+			reporter.close()
+		})
+
+		Convey("is dropped once the reporter is closed", func() {
+			reporter := newProgressReporter(log.add, time.Millisecond)
+			reporter.close()
+			reporter.report(Progress{File: "a.csv"})
+			So(log.events, ShouldBeEmpty)
+		})
+
+		Convey("is ignored by stages outside of a Job", func() {
+			stage := NewStage()
+			progress := stage.TrackProgress("a.csv", 10)
+			progress.AddRecords(1)
+			stage.ReportProgress(Progress{File: "a.csv"})
+		})
+
+		Convey("is reported by the Opener", func() {
+			dir, err := ioutil.TempDir("", "ingest-progress-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			filePath := filepath.Join(dir, "people.csv")
+			So(ioutil.WriteFile(filePath, []byte("name\nada\n"), 0644), ShouldBeNil)
+
+			mem := NewMemFileSystem()
+			mem.WriteFile("memprogress://drop/people.csv", []byte("name\nada\nbob\n"))
+			RegisterFileSystem("memprogress", mem)
+
+			run := func(path string, opts OpenOpts) {
+				out := make(chan interface{})
+				errChan := Open(path, opts).StreamTo(out).Build().OnProgress(log.add).RunAsync()
+				for rec := range out {
+					rec.(*File).Close()
+				}
+				So(<-errChan, ShouldBeNil)
+			}
+
+			Convey("for local files once they are emitted", func() {
+				run(filePath, OpenOpts{})
+				progress, found := log.last("Opener", filePath)
+				So(found, ShouldBeTrue)
+				So(progress, ShouldResemble, Progress{Stage: "Opener", File: filePath, BytesDone: 9, BytesTotal: 9, RecordsEmitted: 1})
+			})
+
+			Convey("for remote files as they are downloaded", func() {
+				Reset(func() { os.RemoveAll("test/tmp-progress") })
+				run("memprogress://drop/people.csv", OpenOpts{TempDir: "test/tmp-progress"})
+				progress, found := log.last("Opener", "memprogress://drop/people.csv")
+				So(found, ShouldBeTrue)
+				So(progress.BytesDone, ShouldEqual, 13)
+				So(progress.RecordsEmitted, ShouldEqual, 1)
+			})
+		})
+	})
+}
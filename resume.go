@@ -0,0 +1,216 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"time"
+)
+
+// maxRetryBackoff is the longest wait between retries
+const maxRetryBackoff = 30 * time.Second
+
+type (
+	// retryPolicy is how transient failures are retried. Waiting for a retry stops once abort
+	// receives or is closed
+	retryPolicy struct {
+		retries int
+		backoff time.Duration
+		abort   <-chan chan error
+	}
+
+	// resumingReader reads a file from a ConditionalFileSystem, reopening it where it left off
+	// when a read fails with a transient error
+	resumingReader struct {
+		fileSystem ConditionalFileSystem
+		path       string
+		retry      retryPolicy
+		logger     Logger
+
+		body    io.ReadCloser
+		version Version
+		offset  int64
+
+		// failed is an error that was held back so that the bytes read with it could be returned
+		failed error
+
+		// attempts is the number of retries since the last progress was made
+		attempts  int
+		resumedAt int64
+
+		// onComplete is called with the version of the file once it is read to the end
+		onComplete func(version Version)
+	}
+)
+
+// delay is how long to wait before a retry, which doubles with each attempt
+func (r retryPolicy) delay(attempt int) time.Duration {
+	delay := r.backoff
+	for i := 0; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+// wait waits before a retry, returning errAborted if the retry is aborted first
+func (r retryPolicy) wait(attempt int) error {
+	timer := time.NewTimer(r.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-r.abort:
+		return errAborted
+	case <-timer.C:
+		return nil
+	}
+}
+
+// do calls fn until it succeeds, fails with an error that isn't transient, or runs out of retries.
+// It returns errAborted if it is aborted while waiting to retry
+func (r retryPolicy) do(logger Logger, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) || attempt >= r.retries {
+			return err
+		}
+
+		logger.WithError(err).Warn("Retrying after transient error")
+		if err := r.wait(attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// isTransient checks whether an error may go away if the request is retried, such as a
+// dropped connection, a timeout or a server error. Other network errors, like a host that
+// doesn't resolve or a refused connection, aren't retried
+func isTransient(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// openResuming opens the file, retrying transient failures. It returns ErrNotModified if the
+// file is still the version since
+func openResuming(fileSystem ConditionalFileSystem, path string, since Version, retry retryPolicy, logger Logger) (*resumingReader, *ConditionalResponse, error) {
+	var resp *ConditionalResponse
+	err := retry.do(logger, func() (err error) {
+		resp, err = fileSystem.OpenConditional(path, ConditionalRequest{IfChanged: since})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &resumingReader{
+		fileSystem: fileSystem,
+		path:       path,
+		retry:      retry,
+		logger:     logger,
+		body:       resp.ReadCloser,
+		version:    resp.Version,
+	}, resp, nil
+}
+
+// Read implements io.Reader for resumingReader
+func (r *resumingReader) Read(p []byte) (int, error) {
+	if r.failed != nil {
+		failed := r.failed
+		r.failed = nil
+		if err := r.resume(failed); err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+
+		switch {
+		case err == io.EOF:
+			if r.onComplete != nil {
+				r.onComplete(r.version)
+				r.onComplete = nil
+			}
+			return n, err
+		case err == nil:
+			return n, nil
+		case n > 0:
+			r.failed = err
+			return n, nil
+		}
+
+		if err := r.resume(err); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close implements io.Closer for resumingReader
+func (r *resumingReader) Close() error {
+	return r.body.Close()
+}
+
+// resume reopens the file where it was left off after a read failed with cause. Retries are
+// counted from the last time any progress was made, so that long reads survive occasional drops.
+// It returns errAborted if it is aborted while waiting to retry
+func (r *resumingReader) resume(cause error) error {
+	r.body.Close()
+	if !isTransient(cause) {
+		return cause
+	}
+	if r.offset > r.resumedAt {
+		r.attempts = 0
+		r.resumedAt = r.offset
+	}
+
+	for ; r.attempts < r.retry.retries; r.attempts++ {
+		r.logger.WithError(cause).WithField("offset", r.offset).Warn("Resuming interrupted read")
+		if err := r.retry.wait(r.attempts); err != nil {
+			return err
+		}
+
+		resp, err := r.fileSystem.OpenConditional(r.path, ConditionalRequest{Offset: r.offset, IfRange: r.version})
+		if err != nil {
+			if !isTransient(err) {
+				return err
+			}
+			cause = err
+			continue
+		}
+
+		if !resp.Version.Matches(r.version) || resp.Offset > r.offset {
+			resp.Close()
+			return fmt.Errorf("%s changed while it was being read", r.path)
+		}
+
+		// Servers that don't support ranges send the whole file again
+		if _, err := io.CopyN(ioutil.Discard, resp, r.offset-resp.Offset); err == io.EOF {
+			resp.Close()
+			return fmt.Errorf("%s changed while it was being read", r.path)
+		} else if err != nil {
+			resp.Close()
+			cause = err
+			continue
+		}
+
+		r.body = resp.ReadCloser
+		r.attempts++
+		return nil
+	}
+
+	return cause
+}
@@ -0,0 +1,302 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyServer serves a file at /data.bin, dropping the connection part way through the first
+// drops responses, or before sending anything if stall is set. The first failures responses
+// are server errors
+type flakyServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	content      []byte
+	etag         string
+	drops        int
+	stall        bool
+	changeOnDrop bool
+	failures     int
+	ignoreRange  bool
+	requests     []*http.Request
+}
+
+func newFlakyServer(content []byte) *flakyServer {
+	server := &flakyServer{content: content, etag: `"v1"`}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+func (f *flakyServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/data.bin" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	content, etag, stall, ignoreRange := f.content, f.etag, f.stall, f.ignoreRange
+	drop := f.drops > 0 && r.Method == "GET"
+	if drop {
+		f.drops--
+		if f.changeOnDrop {
+			f.etag = `"v2"`
+		}
+	}
+	fail := f.failures > 0 && r.Method == "GET"
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+
+	if fail {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	start := 0
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && !ignoreRange && r.Header.Get("If-Range") == etag {
+		fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)-start))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+	}
+
+	body := content[start:]
+	if drop {
+		// Send part of the body, then drop the connection
+		if !stall {
+			w.Write(body[:len(body)/2])
+		}
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(body)
+}
+
+func (f *flakyServer) rangeRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ranges := []string{}
+	for _, r := range f.requests {
+		if r.Method == "GET" && r.Header.Get("Range") != "" {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+	}
+	return ranges
+}
+
+func TestResumingOpener(t *testing.T) {
+	Convey("Opening HTTP files", t, func() {
+		content := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+		server := newFlakyServer(content)
+		Reset(server.Close)
+		url := server.URL + "/data.bin"
+
+		// read runs an Opener, returning the contents of the files it emitted
+		read := func(opts OpenOpts) ([][]byte, error) {
+			opts.RetryBackoff = time.Millisecond
+			out := make(chan interface{})
+			errChan := NewPipeline().Then(NewOpener(url, opts)).StreamTo(out).Build().RunAsync()
+
+			var contents [][]byte
+			var readErr error
+			for rec := range out {
+				file := rec.(*File)
+				data, err := ioutil.ReadAll(file)
+				file.Close()
+				if err != nil && readErr == nil {
+					readErr = err
+				}
+				contents = append(contents, data)
+			}
+			if err := <-errChan; err != nil {
+				return contents, err
+			}
+			return contents, readErr
+		}
+
+		Convey("resumes reads from where the connection dropped", func() {
+			server.drops = 2
+			contents, err := read(OpenOpts{})
+			So(err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 1)
+			So(bytes.Equal(contents[0], content), ShouldBeTrue)
+
+			ranges := server.rangeRequests()
+			So(ranges, ShouldHaveLength, 2)
+			So(ranges[0], ShouldEqual, fmt.Sprintf("bytes=%d-", len(content)/2))
+		})
+
+		Convey("resumes downloads to TempDir", func() {
+			dir, err := ioutil.TempDir("", "ingest-resume-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+
+			server.drops = 3
+			contents, err := read(OpenOpts{TempDir: filepath.Join(dir, "tmp")})
+			So(err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 1)
+			So(bytes.Equal(contents[0], content), ShouldBeTrue)
+		})
+
+		Convey("resumes from servers that ignore ranges", func() {
+			server.drops = 1
+			server.ignoreRange = true
+			contents, err := read(OpenOpts{})
+			So(err, ShouldBeNil)
+			So(bytes.Equal(contents[0], content), ShouldBeTrue)
+		})
+
+		Convey("fails once it runs out of retries", func() {
+			server.drops = 10
+			server.stall = true
+			_, err := read(OpenOpts{Retries: 2})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("fails if the file changes while it is being read", func() {
+			server.drops = 1
+			server.changeOnDrop = true
+			_, err := read(OpenOpts{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "changed")
+		})
+
+		Convey("retries server errors when opening", func() {
+			server.failures = 2
+			contents, err := read(OpenOpts{})
+			So(err, ShouldBeNil)
+			So(bytes.Equal(contents[0], content), ShouldBeTrue)
+		})
+
+		Convey("stops waiting to resume once the Opener is aborted", func() {
+			server.drops = 1
+			opener := NewOpener(url, OpenOpts{RetryBackoff: time.Hour})
+			abort := make(chan chan error)
+			stage := &Stage{Out: make(chan interface{}), Abort: abort}
+			go opener.Run(stage)
+			file := (<-stage.Out).(*File)
+
+			readErr := make(chan error, 1)
+			go func() {
+				_, err := ioutil.ReadAll(file)
+				readErr <- err
+			}()
+			select {
+			case <-readErr:
+				t.Fatal("read finished before the Opener was aborted")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			abort <- make(chan error, 1)
+			select {
+			case err := <-readErr:
+				So(err, ShouldEqual, errAborted)
+			case <-time.After(time.Second):
+				t.Fatal("read kept waiting after the Opener was aborted")
+			}
+			file.Close()
+			So(opener.OnPipelineDone(), ShouldBeNil)
+		})
+
+		Convey("only retries transient network errors", func() {
+			So(isTransient(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), ShouldBeTrue)
+			So(isTransient(&net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}), ShouldBeTrue)
+			So(isTransient(io.ErrUnexpectedEOF), ShouldBeTrue)
+			So(isTransient(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"}}), ShouldBeFalse)
+			So(isTransient(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), ShouldBeFalse)
+		})
+
+		Convey("doesn't retry client errors", func() {
+			url = server.URL + "/missing"
+			_, err := read(OpenOpts{})
+			So(err, ShouldNotBeNil)
+			So(err.(*HTTPStatusError).StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("skips unchanged files with a StateFile", func() {
+			dir, err := ioutil.TempDir("", "ingest-resume-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			stateFile := filepath.Join(dir, "state.json")
+
+			contents, err := read(OpenOpts{StateFile: stateFile})
+			So(err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 1)
+
+			state, err := ioutil.ReadFile(stateFile)
+			So(err, ShouldBeNil)
+			So(string(state), ShouldContainSubstring, `\"v1\"`)
+
+			contents, err = read(OpenOpts{StateFile: stateFile})
+			So(err, ShouldBeNil)
+			So(contents, ShouldHaveLength, 0)
+
+			Convey("but opens them again once they change", func() {
+				server.etag = `"v2"`
+				contents, err := read(OpenOpts{StateFile: stateFile})
+				So(err, ShouldBeNil)
+				So(contents, ShouldHaveLength, 1)
+				So(strings.Count(string(contents[0]), "0123"), ShouldEqual, 1<<16)
+			})
+		})
+
+		Convey("only remembers files in the StateFile once the job succeeds", func() {
+			dir, err := ioutil.TempDir("", "ingest-resume-")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			stateFile := filepath.Join(dir, "state.json")
+
+			Convey("and they pass verification", func() {
+				_, err := read(OpenOpts{StateFile: stateFile, ExpectSHA256: strings.Repeat("0", 64)})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "SHA256")
+
+				contents, err := read(OpenOpts{StateFile: stateFile})
+				So(err, ShouldBeNil)
+				So(contents, ShouldHaveLength, 1)
+			})
+
+			Convey("and the later stages succeed", func() {
+				err := NewPipeline().Then(NewOpener(url, OpenOpts{StateFile: stateFile})).ForEach(func(rec interface{}) (interface{}, error) {
+					file := rec.(*File)
+					defer file.Close()
+					if _, err := ioutil.ReadAll(file); err != nil {
+						return nil, err
+					}
+					return nil, fmt.Errorf("boom")
+				}).Build().Run()
+				So(err, ShouldNotBeNil)
+
+				_, err = os.Stat(stateFile)
+				So(os.IsNotExist(err), ShouldBeTrue)
+
+				contents, err := read(OpenOpts{StateFile: stateFile})
+				So(err, ShouldBeNil)
+				So(contents, ShouldHaveLength, 1)
+			})
+		})
+	})
+}
@@ -35,6 +35,14 @@ type OnDone interface {
 	OnPipelineDone() error
 }
 
+// OnFail is an interface which a Runner can implement to be told that the
+// pipeline failed or was aborted (with ErrAborted), before its OnPipelineDone
+// is called
+type OnFail interface {
+	Runner
+	OnPipelineFailed(err error)
+}
+
 // NoOpRunner allows a runner to specify that it shouldn't be added
 // to the run pipeline at add time
 type NoOpRunner interface {
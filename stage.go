@@ -5,6 +5,10 @@ type Stage struct {
 	In    chan interface{}
 	Out   chan interface{}
 	Abort <-chan chan error
+
+	// progress receives the Progress reported by the stage, and runner is the name of its Runner
+	progress *progressReporter
+	runner   string
 }
 
 // NewStage builds a blank Stage.
@@ -0,0 +1,34 @@
+package ingest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// readStateFile decodes the JSON state file into state. It leaves state as it is if the file
+// doesn't exist
+func readStateFile(filePath string, state interface{}) error {
+	contents, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, state)
+}
+
+// writeStateFile encodes the state to the JSON state file. It is written to a temporary file
+// first, so that it is never left half written
+func writeStateFile(filePath string, state interface{}) error {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
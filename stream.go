@@ -93,3 +93,179 @@ func (t *TransformStream) Run(stage *Stage) error {
 func (t *TransformStream) SkipAbortErr() bool {
 	return true
 }
+
+// A FilterStream is a stream which only emits the records its filter function keeps
+type FilterStream struct {
+	name     string
+	filterFn FilterFn
+}
+
+// A FilterFn is the function signature used by the FilterStream. It returns whether the record is kept
+type FilterFn func(rec interface{}) (keep bool, err error)
+
+// NewFilterStream builds a stream which filters the records of the input channel
+func NewFilterStream(name string, filterFn FilterFn) *FilterStream {
+	return &FilterStream{
+		name:     name,
+		filterFn: filterFn,
+	}
+}
+
+// Name implements Runner for FilterStream
+func (f *FilterStream) Name() string {
+	return f.name
+}
+
+// Run implements Runner for FilterStream
+func (f *FilterStream) Run(stage *Stage) error {
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+			keep, err := f.filterFn(rec)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				continue
+			}
+
+			select {
+			case <-stage.Abort:
+				return nil
+			case stage.Out <- rec:
+				continue
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (f *FilterStream) SkipAbortErr() bool {
+	return true
+}
+
+// A FlatMapStream is a stream which emits any number of records for each record it receives
+type FlatMapStream struct {
+	name      string
+	flatMapFn FlatMapFn
+}
+
+// A FlatMapFn is the function signature used by the FlatMapStream. It calls emit for each record
+// that it emits
+type FlatMapFn func(rec interface{}, emit func(interface{})) error
+
+// NewFlatMapStream builds a stream which runs the flat map function on the records of the input channel
+func NewFlatMapStream(name string, flatMapFn FlatMapFn) *FlatMapStream {
+	return &FlatMapStream{
+		name:      name,
+		flatMapFn: flatMapFn,
+	}
+}
+
+// Name implements Runner for FlatMapStream
+func (f *FlatMapStream) Name() string {
+	return f.name
+}
+
+// Run implements Runner for FlatMapStream
+//
+// Once the stage is aborted the records emitted are dropped, and the stage stops as soon as the
+// flat map function returns
+func (f *FlatMapStream) Run(stage *Stage) error {
+	aborted := false
+	emit := func(rec interface{}) {
+		if aborted {
+			return
+		}
+		select {
+		case <-stage.Abort:
+			aborted = true
+		case stage.Out <- rec:
+		}
+	}
+
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				return nil
+			}
+			err := f.flatMapFn(rec, emit)
+			if aborted {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (f *FlatMapStream) SkipAbortErr() bool {
+	return true
+}
+
+// A ReduceStream is a stream which combines every record it receives into a single result, which
+// it emits once its input is closed
+type ReduceStream struct {
+	name     string
+	init     interface{}
+	reduceFn ReduceFn
+}
+
+// A ReduceFn is the function signature used by the ReduceStream. It returns the accumulated result
+// of combining rec with acc
+type ReduceFn func(acc interface{}, rec interface{}) (interface{}, error)
+
+// NewReduceStream builds a stream which reduces the records of the input channel, starting from init
+func NewReduceStream(name string, init interface{}, reduceFn ReduceFn) *ReduceStream {
+	return &ReduceStream{
+		name:     name,
+		init:     init,
+		reduceFn: reduceFn,
+	}
+}
+
+// Name implements Runner for ReduceStream
+func (r *ReduceStream) Name() string {
+	return r.name
+}
+
+// Run implements Runner for ReduceStream
+//
+// init is emitted if there are no records. Nothing is emitted if the stage is aborted
+func (r *ReduceStream) Run(stage *Stage) error {
+	acc := r.init
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				select {
+				case <-stage.Abort:
+				case stage.Out <- acc:
+				}
+				return nil
+			}
+
+			var err error
+			if acc, err = r.reduceFn(acc, rec); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (r *ReduceStream) SkipAbortErr() bool {
+	return true
+}
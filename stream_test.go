@@ -0,0 +1,128 @@
+package ingest
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStreams(t *testing.T) {
+	// run runs the pipeline over the records, returning the records it emitted and its error
+	run := func(p *Pipeline) ([]interface{}, error) {
+		out := make(chan interface{})
+		errChan := p.StreamTo(out).Build().RunAsync()
+		results := []interface{}{}
+		for rec := range out {
+			results = append(results, rec)
+		}
+		return results, <-errChan
+	}
+
+	// from builds a pipeline that emits the records
+	from := func(records ...interface{}) *Pipeline {
+		in := make(chan interface{}, len(records))
+		for _, rec := range records {
+			in <- rec
+		}
+		close(in)
+		return StreamFrom(in)
+	}
+
+	Convey("Filter", t, func() {
+		Convey("only forwards the records it keeps", func() {
+			results, err := run(from(1, 2, 3, 4).Filter(func(rec interface{}) (bool, error) {
+				return rec.(int)%2 == 0, nil
+			}))
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{2, 4})
+		})
+
+		Convey("fails the pipeline on an error", func() {
+			_, err := run(from(1).Filter(func(rec interface{}) (bool, error) {
+				return false, errors.New("Filter error")
+			}))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Filter error")
+		})
+	})
+
+	Convey("FlatMap", t, func() {
+		Convey("forwards every record emitted", func() {
+			results, err := run(from(0, 1, 2).FlatMap(func(rec interface{}, emit func(interface{})) error {
+				for i := 0; i < rec.(int); i++ {
+					emit(rec)
+				}
+				return nil
+			}))
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{1, 2, 2})
+		})
+
+		Convey("fails the pipeline on an error", func() {
+			_, err := run(from(1).FlatMap(func(rec interface{}, emit func(interface{})) error {
+				return errors.New("FlatMap error")
+			}))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "FlatMap error")
+		})
+
+		Convey("drops the records emitted once aborted", func() {
+			abort := make(chan chan error)
+			stage := &Stage{In: make(chan interface{}), Out: make(chan interface{}), Abort: abort}
+			done := make(chan error)
+			emitted := make(chan int)
+			flatMap := NewFlatMapStream("FlatMap", func(rec interface{}, emit func(interface{})) error {
+				for i := 0; i < 3; i++ {
+					emit(i)
+				}
+				emitted <- 3
+				return errors.New("ignored once aborted")
+			})
+			go func() { done <- flatMap.Run(stage) }()
+
+			stage.In <- "rec"
+			So(<-stage.Out, ShouldEqual, 0)
+			abort <- make(chan error)
+			So(<-emitted, ShouldEqual, 3)
+			So(<-done, ShouldBeNil)
+		})
+	})
+
+	Convey("Reduce", t, func() {
+		sum := func(acc interface{}, rec interface{}) (interface{}, error) {
+			return acc.(int) + rec.(int), nil
+		}
+
+		Convey("emits a single result once the input is closed", func() {
+			results, err := run(from(1, 2, 3).Reduce(10, sum))
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{16})
+		})
+
+		Convey("emits init when there are no records", func() {
+			results, err := run(from().Reduce(10, sum))
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []interface{}{10})
+		})
+
+		Convey("fails the pipeline on an error", func() {
+			results, err := run(from(1).Reduce(0, func(acc interface{}, rec interface{}) (interface{}, error) {
+				return nil, errors.New("Reduce error")
+			}))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Reduce error")
+			So(results, ShouldBeEmpty)
+		})
+
+		Convey("emits nothing on abort", func() {
+			abort := make(chan chan error)
+			stage := &Stage{In: make(chan interface{}), Out: make(chan interface{}), Abort: abort}
+			done := make(chan error)
+			go func() { done <- NewReduceStream("Reduce", 0, sum).Run(stage) }()
+
+			stage.In <- 1
+			abort <- make(chan error)
+			So(<-done, ShouldBeNil)
+		})
+	})
+}
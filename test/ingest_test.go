@@ -3,6 +3,7 @@ package ingest_test
 import (
 	"github.com/urbint/ingest"
 	"github.com/urbint/ingest/parse"
+	"github.com/urbint/ingest/process"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
@@ -29,6 +30,45 @@ func TestIngest(t *testing.T) {
 		So(<-err, ShouldBeNil)
 		So(results, ShouldHaveLength, 5)
 	})
+
+	Convey("Parsing shapefiles from archives", t, func() {
+		// features parses the shapefile in an archive, returning how many features it had
+		features := func(archive string, runner ingest.Runner) (int, error) {
+			out := make(chan interface{})
+			err := ingest.Open(archive).
+				Then(runner).
+				Then(parse.Shapefile(nil)).
+				StreamTo(out).Build().RunAsync()
+
+			count := 0
+			for range out {
+				count++
+			}
+			return count, <-err
+		}
+
+		Convey("unzips a shapefile without a .prj", func() {
+			count, err := features("../test/fixtures/noprj.zip", process.Unzip())
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("untars a shapefile", func() {
+			count, err := features("../test/fixtures/shapefile.tar", process.Untar())
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("extracts shapefiles", func() {
+			count, err := features("../test/fixtures/shapefile.tar", process.Extract())
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+
+			count, err = features("../test/fixtures/noprj.zip", process.Extract())
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+	})
 }
 
 type Person struct {
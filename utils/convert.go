@@ -10,6 +10,7 @@ import (
 // ToIOReadCloser converts the specified input to an IOReadCloser.
 //
 // If it cannot be converted, an error will be returned.
+// Anything that is already an io.ReadCloser, such as an *ingest.File, is returned as is.
 // If the interface is an IOReader and does not implement
 // a Close method, a NoOp close method will be added
 func ToIOReadCloser(input interface{}) (io.ReadCloser, error) {
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"encoding"
 	"reflect"
 	"strings"
 )
 
+// textMarshalerType is the type of encoding.TextMarshaler
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
 // MapFromStructTag builds a hash map using the string specified by tagName as the keys
 //
 // If dest is specified, it will be used as the map where the result is stored. Otherwise a new
@@ -12,6 +16,9 @@ import (
 //
 // Optionally omitempty may be added to the value to cause a zero value of the field to be
 // omitted from the map entirely
+//
+// Nested structs become nested maps, except for those that marshal themselves to text
+// (ie. time.Time) which are kept as they are. Unexported fields are skipped
 func MapFromStructTag(src interface{}, tagName string, dest ...map[string]interface{}) map[string]interface{} {
 	var result map[string]interface{}
 
@@ -26,6 +33,9 @@ func MapFromStructTag(src interface{}, tagName string, dest ...map[string]interf
 
 	for i := 0; i < srcType.NumField(); i++ {
 		srcStructField := srcType.Field(i)
+		if srcStructField.PkgPath != "" && !srcStructField.Anonymous {
+			continue
+		}
 		tagValues := strings.Split(srcStructField.Tag.Get(tagName), ",")
 
 		if tagValues[0] == "-" {
@@ -48,7 +58,7 @@ func MapFromStructTag(src interface{}, tagName string, dest ...map[string]interf
 
 		if omitEmpty && reflect.DeepEqual(reflect.Zero(srcStructField.Type).Interface(), iFieldVal) {
 			continue
-		} else if srcStructField.Type.Kind() == reflect.Struct {
+		} else if srcStructField.Type.Kind() == reflect.Struct && !srcStructField.Type.Implements(textMarshalerType) {
 			if srcStructField.Anonymous {
 				MapFromStructTag(fieldVal.Interface(), tagName, result)
 			} else {
@@ -4,6 +4,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 
 	"testing"
+	"time"
 )
 
 func TestMapFromStructTag(t *testing.T) {
@@ -24,6 +25,8 @@ func TestMapFromStructTag(t *testing.T) {
 		Omit      string `mytag:"-"`
 		Default   string
 		Nested    Nested
+		When      time.Time `mytag:"when"`
+		private   string
 	}
 
 	Convey("MapFromStructTag", t, func() {
@@ -39,6 +42,8 @@ func TestMapFromStructTag(t *testing.T) {
 				Nested: Nested{
 					Supported: true,
 				},
+				When:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				private: "private",
 			}, "mytag")
 
 			Convey("allows specifying custom field names", func() {
@@ -64,6 +69,15 @@ func TestMapFromStructTag(t *testing.T) {
 				So(nestedMap["supported"], ShouldBeTrue)
 			})
 
+			Convey("keeps structs that marshal themselves to text", func() {
+				So(vals["when"], ShouldResemble, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+			})
+
+			Convey("skips unexported fields", func() {
+				_, hasPrivate := vals["private"]
+				So(hasPrivate, ShouldBeFalse)
+			})
+
 			Convey("puts anonymous structs on the top level", func() {
 				So(vals["Anonymous"], ShouldBeNil)
 				So(vals["base"], ShouldEqual, "Test")
@@ -0,0 +1,344 @@
+package ingest
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/urbint/ingest/utils"
+)
+
+// DefaultWatchStateFile is the name of the state file kept in the watched directory if
+// WatchOpts.StateFile isn't specified
+const DefaultWatchStateFile = ".ingest-watch.json"
+
+type (
+	// A Watcher is a Runner that watches a directory, emitting new and modified files
+	Watcher struct {
+		Opts   WatchOpts
+		logger Logger
+		dir    string
+
+		// processed are the files already ingested, by their slash separated path within dir
+		processed map[string]watchedFile
+
+		// emitted are the files that have been emitted, but not yet read to the end or closed
+		emitted map[string]watchedFile
+
+		// mu guards processed and emitted, which are updated as the later stages finish with files
+		mu sync.Mutex
+
+		// pending are the files that have changed, and are waiting to settle
+		pending map[string]pendingFile
+	}
+
+	// WatchOpts is used to configure a Watcher
+	WatchOpts struct {
+		// Pattern is the glob pattern that files within the directory must match, ie. **/*.csv.
+		// ** matches any number of directories. Defaults to every file
+		Pattern string
+
+		// Settle is how long a file must go unchanged before it is emitted. Defaults to 5 seconds
+		Settle time.Duration
+
+		// PollInterval is how often the directory is checked for changes. Defaults to 10 seconds
+		PollInterval time.Duration
+
+		// StateFile is where the files already ingested are remembered across restarts.
+		// Defaults to DefaultWatchStateFile within the watched directory
+		StateFile string
+
+		// Logger is the logger that the Watcher will log to
+		Logger Logger
+	}
+
+	// watchedFile identifies the version of a file that was seen
+	watchedFile struct {
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"modTime"`
+	}
+
+	// pendingFile is a changed file, along with when it was first seen as that version
+	pendingFile struct {
+		watchedFile
+		since time.Time
+	}
+
+	// watchState is the contents of the state file
+	watchState struct {
+		Files map[string]watchedFile `json:"files"`
+	}
+
+	// settledFile is an emitted file, which is recorded as processed once it is read to the end
+	// or closed
+	settledFile struct {
+		*os.File
+		once   sync.Once
+		onDone func()
+	}
+)
+
+func defaultWatchOpts() WatchOpts {
+	return WatchOpts{
+		Pattern:      "**",
+		Settle:       5 * time.Second,
+		PollInterval: 10 * time.Second,
+		Logger:       DefaultLogger,
+	}
+}
+
+// NewWatcher builds a Watcher which will watch the specified directory
+func NewWatcher(dir string, opts ...WatchOpts) *Watcher {
+	var opt = defaultWatchOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+	if opt.StateFile == "" {
+		opt.StateFile = filepath.Join(dir, DefaultWatchStateFile)
+	}
+
+	return &Watcher{
+		logger: opt.Logger.WithField("dir", dir),
+		dir:    dir,
+		Opts:   opt,
+	}
+}
+
+// Watch is a shortcut to create a new Pipeline that starts with a Watcher of the
+// specified directory.
+//
+// It runs until the pipeline is aborted, polling the directory for files matching
+// WatchOpts.Pattern. Each new or modified file is emitted as an *ingest.File once it has
+// stopped changing for WatchOpts.Settle.
+//
+// Each file is remembered in WatchOpts.StateFile once the later stages have read it to the end or
+// closed it, so that it isn't emitted again after a restart. A file emitted before a crash is
+// emitted again, while one that is closed before it has been ingested is not: delivery is
+// at-most-once for files that are closed early
+func Watch(dir string, opts ...WatchOpts) *Pipeline {
+	return NewPipeline().Then(NewWatcher(dir, opts...))
+}
+
+// Name implements the Runner interface for the Watcher
+func (w *Watcher) Name() string {
+	return "Watcher"
+}
+
+// Run implements Runner for Watcher
+func (w *Watcher) Run(stage *Stage) error {
+	if stage.Out == nil {
+		return nil // Nothing to do here
+	}
+	if err := validateGlob(w.Opts.Pattern); err != nil {
+		return err
+	}
+	if err := w.loadState(); err != nil {
+		return err
+	}
+	w.pending = map[string]pendingFile{}
+	w.emitted = map[string]watchedFile{}
+
+	w.logger.Info("Watching directory")
+	for {
+		if err := w.poll(stage); err == errAborted {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		select {
+		case <-stage.Abort:
+			return nil
+		case <-time.After(w.Opts.PollInterval):
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (w *Watcher) SkipAbortErr() bool {
+	return true
+}
+
+// poll checks the directory for changes, emitting the files which have settled
+func (w *Watcher) poll(stage *Stage) error {
+	stateFile, _ := filepath.Abs(w.Opts.StateFile)
+	seen := map[string]bool{}
+	var settled []string
+
+	err := filepath.WalkDir(w.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-stage.Abort:
+			return errAborted
+		default:
+		}
+
+		rel, err := filepath.Rel(w.dir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel != "." && !globCanDescend(w.Opts.Pattern, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !matchGlob(w.Opts.Pattern, rel) {
+			return nil
+		}
+		if abs, _ := filepath.Abs(filePath); abs == stateFile || abs == stateFile+".tmp" {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		seen[rel] = true
+		version := watchedFile{Size: info.Size(), ModTime: info.ModTime()}
+		if w.handled(rel, version) {
+			delete(w.pending, rel)
+			return nil
+		}
+
+		pending, isPending := w.pending[rel]
+		if !isPending || !pending.same(version) {
+			w.pending[rel] = pendingFile{watchedFile: version, since: time.Now()}
+			return nil
+		}
+		if time.Since(pending.since) >= w.Opts.Settle {
+			settled = append(settled, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range w.pending {
+		if !seen[rel] {
+			delete(w.pending, rel)
+		}
+	}
+	if err := w.prune(seen); err != nil {
+		return err
+	}
+
+	for _, rel := range settled {
+		w.logger.WithField("file", rel).Info("Emitting settled file")
+		version := w.pending[rel].watchedFile
+		w.mu.Lock()
+		w.emitted[rel] = version
+		w.mu.Unlock()
+
+		err := emitFile(filepath.Join(w.dir, filepath.FromSlash(rel)), stage, func(file *File, osFile *os.File) error {
+			file.ReadCloser = &settledFile{File: osFile, onDone: func() { w.ingested(rel, version) }}
+			return nil
+		})
+		delete(w.pending, rel)
+		if err != nil {
+			w.mu.Lock()
+			delete(w.emitted, rel)
+			w.mu.Unlock()
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// handled checks whether the version of a file has already been ingested, or is being ingested
+func (w *Watcher) handled(rel string, version watchedFile) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if processed, isProcessed := w.processed[rel]; isProcessed && processed.same(version) {
+		return true
+	}
+	emitted, isEmitted := w.emitted[rel]
+	return isEmitted && emitted.same(version)
+}
+
+// prune forgets the files that have been removed, so the state file doesn't grow forever
+func (w *Watcher) prune(seen map[string]bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pruned := false
+	for rel := range w.processed {
+		if !seen[rel] {
+			delete(w.processed, rel)
+			pruned = true
+		}
+	}
+	if pruned {
+		return w.saveState()
+	}
+	return nil
+}
+
+// ingested records a file as processed once the later stages are done with it
+func (w *Watcher) ingested(rel string, version watchedFile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if emitted, isEmitted := w.emitted[rel]; isEmitted && emitted.same(version) {
+		delete(w.emitted, rel)
+	}
+	w.processed[rel] = version
+	if err := w.saveState(); err != nil {
+		w.logger.WithError(err).WithField("file", rel).Error("Failed to save the watch state")
+	}
+}
+
+// same checks whether two versions of a file have the same size and modification time
+func (f watchedFile) same(other watchedFile) bool {
+	return f.Size == other.Size && f.ModTime.Equal(other.ModTime)
+}
+
+// loadState reads the files already ingested from the state file, if it exists
+func (w *Watcher) loadState() error {
+	var state watchState
+	if err := readStateFile(w.Opts.StateFile, &state); err != nil {
+		return err
+	}
+
+	w.processed = state.Files
+	if w.processed == nil {
+		w.processed = map[string]watchedFile{}
+	}
+	return nil
+}
+
+// saveState writes the files already ingested to the state file. It must be called with mu held
+func (w *Watcher) saveState() error {
+	return writeStateFile(w.Opts.StateFile, watchState{Files: w.processed})
+}
+
+// Read implements io.Reader for settledFile, recording the file once it is read to the end
+func (s *settledFile) Read(p []byte) (int, error) {
+	n, err := s.File.Read(p)
+	if err == io.EOF {
+		s.once.Do(s.onDone)
+	}
+	return n, err
+}
+
+// Close implements io.Closer for settledFile, recording the file
+func (s *settledFile) Close() error {
+	err := s.File.Close()
+	s.once.Do(s.onDone)
+	return err
+}
@@ -0,0 +1,118 @@
+package ingest
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	Convey("Watcher", t, func() {
+		dir, err := ioutil.TempDir("", "ingest-watch-")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		opts := WatchOpts{Pattern: "**/*.csv", Settle: 20 * time.Millisecond, PollInterval: 5 * time.Millisecond}
+
+		// start runs a Watcher until stop is called, which returns the error it finished with
+		start := func() (out chan interface{}, stop func() error) {
+			abort := make(chan chan error)
+			out = make(chan interface{})
+			stage := &Stage{In: make(chan interface{}), Out: out, Abort: abort}
+			done := make(chan error, 1)
+			go func() { done <- NewWatcher(dir, opts).Run(stage) }()
+			return out, func() error {
+				abort <- make(chan error, 1)
+				return <-done
+			}
+		}
+
+		// within returns the path within dir of the next file emitted, or an empty string if
+		// nothing is emitted before wait
+		within := func(out chan interface{}, wait time.Duration) string {
+			select {
+			case rec := <-out:
+				file := rec.(*File)
+				file.Close()
+				rel, _ := filepath.Rel(dir, file.Path)
+				return filepath.ToSlash(rel)
+			case <-time.After(wait):
+				return ""
+			}
+		}
+		next := func(out chan interface{}) string {
+			return within(out, 200*time.Millisecond)
+		}
+
+		write := func(name string, contents string) {
+			filePath := filepath.Join(dir, filepath.FromSlash(name))
+			So(os.MkdirAll(filepath.Dir(filePath), 0770), ShouldBeNil)
+			So(ioutil.WriteFile(filePath, []byte(contents), 0660), ShouldBeNil)
+		}
+
+		Convey("emits new files matching the pattern once they settle", func() {
+			write("ignored.txt", "nope")
+			out, stop := start()
+
+			write("drop/people.csv", "name\nBob\n")
+			So(next(out), ShouldEqual, "drop/people.csv")
+			So(next(out), ShouldEqual, "")
+
+			Convey("and emits them again once modified", func() {
+				write("drop/people.csv", "name\nBob\nAlice\n")
+				So(next(out), ShouldEqual, "drop/people.csv")
+				So(stop(), ShouldBeNil)
+			})
+
+			Convey("and remembers them across restarts", func() {
+				So(stop(), ShouldBeNil)
+				_, err := os.Stat(filepath.Join(dir, DefaultWatchStateFile))
+				So(err, ShouldBeNil)
+
+				out, stop := start()
+				So(next(out), ShouldEqual, "")
+
+				write("drop/more.csv", "name\nZed\n")
+				So(next(out), ShouldEqual, "drop/more.csv")
+				So(stop(), ShouldBeNil)
+			})
+		})
+
+		Convey("only remembers files once they are read to the end or closed", func() {
+			out, stop := start()
+			write("people.csv", "name\nBob\n")
+
+			file := (<-out).(*File)
+			So(stop(), ShouldBeNil)
+			defer file.Close()
+
+			out, stop = start()
+			So(next(out), ShouldEqual, "people.csv")
+			So(stop(), ShouldBeNil)
+
+			out, stop = start()
+			So(next(out), ShouldEqual, "")
+			So(stop(), ShouldBeNil)
+		})
+
+		Convey("waits for files to stop changing", func() {
+			opts.Settle = 150 * time.Millisecond
+			out, stop := start()
+
+			write("people.csv", "name\n")
+			time.Sleep(50 * time.Millisecond)
+			write("people.csv", "name\nBob\n")
+			So(within(out, 75*time.Millisecond), ShouldEqual, "")
+			So(next(out), ShouldEqual, "people.csv")
+			So(stop(), ShouldBeNil)
+		})
+
+		Convey("exits cleanly when aborted", func() {
+			_, stop := start()
+			So(stop(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,179 @@
+package write
+
+import (
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urbint/ingest/utils"
+)
+
+// textMarshalerType is the type of encoding.TextMarshaler
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// csvEncoder writes records as the rows of a CSV, with a header of the columns
+type csvEncoder struct {
+	writer      *csv.Writer
+	out         *Writer
+	wroteHeader bool
+}
+
+// CSV returns a *Writer that writes the records it receives to a CSV file at path
+//
+// Structs are written using their csv struct tags, as with parse.CSV, and maps by their keys
+func CSV(path string, opts ...WriteOpts) *Writer {
+	return newWriter("CSV Writer", path, newCSVEncoder, opts)
+}
+
+func newCSVEncoder(w io.Writer, out *Writer) encoder {
+	return &csvEncoder{
+		writer: csv.NewWriter(w),
+		out:    out,
+	}
+}
+
+// encode implements encoder for csvEncoder, writing the header before the first record
+//
+// Each row is flushed through to the file's writer as it is written, so that MaxBytes counts it
+func (c *csvEncoder) encode(rec interface{}) error {
+	values, err := valuesOf(rec, "csv")
+	if err != nil {
+		return err
+	}
+
+	// Later files use the columns of the first, so that every file of a run has the same header
+	if c.out.columns == nil {
+		c.out.columns = columnsOf(rec, values, "csv")
+	}
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	row := make([]string, len(c.out.columns))
+	for i, column := range c.out.columns {
+		row[i] = c.format(values[column])
+	}
+	if err := c.writer.Write(row); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// flush implements encoder for csvEncoder. A file without any records still gets a header, if
+// its columns are known
+func (c *csvEncoder) flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// writeHeader writes the columns once, at the start of the file
+func (c *csvEncoder) writeHeader() error {
+	if c.wroteHeader || c.out.columns == nil {
+		return nil
+	}
+	c.wroteHeader = true
+	return c.writer.Write(c.out.columns)
+}
+
+// format formats a value as it is written to a column
+func (c *csvEncoder) format(value interface{}) string {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return ""
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return ""
+	}
+
+	switch v := val.Interface().(type) {
+	case time.Time:
+		return v.Format(c.out.opts.DateFormat)
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// valuesOf returns the values of a record by their column names
+func valuesOf(rec interface{}, tagName string) (map[string]interface{}, error) {
+	switch v := rec.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case map[string]string:
+		values := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	recType := reflect.TypeOf(rec)
+	for recType != nil && recType.Kind() == reflect.Ptr {
+		recType = recType.Elem()
+	}
+	if recType == nil || recType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can't write a record of type %T", rec)
+	}
+	return utils.MapFromStructTag(rec, tagName), nil
+}
+
+// columnsOf returns the columns of a record in the order its fields are declared, or the sorted
+// keys of a map
+func columnsOf(rec interface{}, values map[string]interface{}, tagName string) []string {
+	recType := reflect.TypeOf(rec)
+	for recType.Kind() == reflect.Ptr {
+		recType = recType.Elem()
+	}
+	if recType.Kind() != reflect.Struct {
+		columns := make([]string, 0, len(values))
+		for column := range values {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		return columns
+	}
+	return fieldColumns(recType, tagName)
+}
+
+// fieldColumns returns the column names of a struct's fields, following the same rules as
+// utils.MapFromStructTag
+func fieldColumns(structType reflect.Type, tagName string) []string {
+	columns := []string{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get(tagName), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !field.Type.Implements(textMarshalerType) {
+			columns = append(columns, fieldColumns(field.Type, tagName)...)
+		} else {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,107 @@
+package write
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	type Base struct {
+		ID int `csv:"id"`
+	}
+
+	type Person struct {
+		Base
+		Name     string    `csv:"name"`
+		Birthday time.Time `csv:"birthday"`
+		Nickname *string   `csv:"nickname"`
+		Ignored  string    `csv:"-"`
+		private  string
+	}
+
+	Convey("CSV", t, func() {
+		dir, err := ioutil.TempDir("", "ingest-csv-")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "people.csv")
+
+		read := func(path string) string {
+			content, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		nickname := "Countess"
+		ada := Person{
+			Base:     Base{ID: 1},
+			Name:     "Ada, Lovelace",
+			Birthday: time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC),
+			Nickname: &nickname,
+			Ignored:  "ignored",
+			private:  "private",
+		}
+		bob := &Person{Base: Base{ID: 2}, Name: "Bob"}
+
+		Convey("writes structs using their csv tags", func() {
+			_, err := run(CSV(path), ada, bob)
+			So(err, ShouldBeNil)
+			So(read(path), ShouldEqual, "id,name,birthday,nickname\n"+
+				"1,\"Ada, Lovelace\",12/10/1815,Countess\n"+
+				"2,Bob,01/01/0001,\n")
+		})
+
+		Convey("writes the Columns given, in order", func() {
+			_, err := run(CSV(path, WriteOpts{Columns: []string{"name", "id"}, DateFormat: "2006"}), ada)
+			So(err, ShouldBeNil)
+			So(read(path), ShouldEqual, "name,id\n\"Ada, Lovelace\",1\n")
+		})
+
+		Convey("writes maps with their keys sorted", func() {
+			_, err := run(CSV(path), map[string]interface{}{"name": "Ada", "id": 1}, map[string]interface{}{"name": "Bob"})
+			So(err, ShouldBeNil)
+			So(read(path), ShouldEqual, "id,name\n1,Ada\n,Bob\n")
+		})
+
+		Convey("writes the header to each file when rotating", func() {
+			paths, err := run(CSV(path, WriteOpts{MaxRecords: 1}), ada, bob)
+			So(err, ShouldBeNil)
+			So(paths, ShouldHaveLength, 2)
+			So(read(paths[1]), ShouldEqual, "id,name,birthday,nickname\n2,Bob,01/01/0001,\n")
+		})
+
+		Convey("rotates files by MaxBytes", func() {
+			records := []interface{}{}
+			for i := 0; i < 50; i++ {
+				records = append(records, bob)
+			}
+			paths, err := run(CSV(path, WriteOpts{MaxBytes: 100}), records...)
+			So(err, ShouldBeNil)
+			So(len(paths), ShouldBeGreaterThan, 1)
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(info.Size(), ShouldBeLessThan, 100+len("2,Bob,01/01/0001,\n"))
+			}
+		})
+
+		Convey("infers the columns again on each run", func() {
+			writer := CSV(path)
+			_, err := run(writer, ada)
+			So(err, ShouldBeNil)
+			_, err = run(writer, map[string]interface{}{"city": "London"})
+			So(err, ShouldBeNil)
+			So(read(path), ShouldEqual, "city\nLondon\n")
+			So(writer.opts.Columns, ShouldBeNil)
+		})
+
+		Convey("fails on records that aren't structs or maps", func() {
+			_, err := run(CSV(path), 42)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "int")
+		})
+	})
+}
@@ -0,0 +1,362 @@
+package write
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// errAborted is returned internally when a batch is abandoned because the stage was aborted
+var errAborted = errors.New("aborted")
+
+type (
+	// A HTTPBulkWriter is a Runner that POSTs the records it receives to a URL in batches
+	//
+	// A batch is only read from the stage once the previous one has been sent, so a slow server
+	// slows the pipeline down rather than records piling up in memory
+	HTTPBulkWriter struct {
+		url    string
+		opts   *BulkOpts
+		logger ingest.Logger
+	}
+
+	// BulkOpts are options used to configure a HTTPBulkWriter
+	BulkOpts struct {
+		// BatchSize is the most records sent in each request. Defaults to 500
+		BatchSize int
+
+		// FlushInterval is how long a partial batch waits for more records before it is sent.
+		// Defaults to 5 seconds. Set to -1 to only send full batches, and the last one
+		FlushInterval time.Duration
+
+		// Encode encodes a batch into the body of a request. Defaults to EncodeNDJSON. Use
+		// EncodeElasticsearchBulk, along with ElasticsearchItemErrors, for an Elasticsearch _bulk URL
+		Encode BulkEncoder
+
+		// ItemErrors finds the records of a batch that the server failed, from the body of its
+		// response. Defaults to treating every record of a successful response as written
+		ItemErrors func(batch []interface{}, body []byte) []ItemError
+
+		// Errors receives the records the server failed. If it isn't set the failures are logged
+		Errors chan<- ItemError
+
+		// MaxRetries is the number of times a request is retried after a 429 or 5xx response, or
+		// a failure to connect. Defaults to 5. Set to -1 to never retry
+		MaxRetries int
+
+		// Backoff is how long the first retry waits, doubling for each retry after it. A Retry-After
+		// header sent by the server is used instead. Defaults to 500 milliseconds
+		Backoff time.Duration
+
+		// Header are the headers sent with each request
+		Header http.Header
+
+		// Client is the client used to send requests. Defaults to http.DefaultClient
+		Client *http.Client
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// A BulkEncoder encodes a batch into the body of a request, returning its Content-Type
+	BulkEncoder func(batch []interface{}) (body []byte, contentType string, err error)
+
+	// An ItemError is a record that the server failed
+	ItemError struct {
+		Record interface{}
+		Status int
+		Err    error
+	}
+)
+
+func defaultBulkOpts() BulkOpts {
+	return BulkOpts{
+		BatchSize:     500,
+		FlushInterval: 5 * time.Second,
+		Encode:        EncodeNDJSON,
+		MaxRetries:    5,
+		Backoff:       500 * time.Millisecond,
+		Client:        http.DefaultClient,
+		Logger:        ingest.DefaultLogger,
+	}
+}
+
+// HTTPBulk returns a *HTTPBulkWriter that POSTs the records it receives to url in batches
+func HTTPBulk(url string, opts ...BulkOpts) *HTTPBulkWriter {
+	opt := defaultBulkOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	return &HTTPBulkWriter{
+		url:    url,
+		opts:   &opt,
+		logger: opt.Logger.WithField("processor", "http bulk writer").WithField("url", url),
+	}
+}
+
+// Error implements error for ItemError
+func (i ItemError) Error() string {
+	return fmt.Sprintf("record failed with status %d: %v", i.Status, i.Err)
+}
+
+// Name implements ingest.Runner for HTTPBulkWriter
+func (h *HTTPBulkWriter) Name() string {
+	return "HTTP Bulk Writer"
+}
+
+// Run implements ingest.Runner for HTTPBulkWriter
+//
+// The last partial batch is sent once the input is closed. If the stage is aborted it is dropped
+func (h *HTTPBulkWriter) Run(stage *ingest.Stage) error {
+	batch := make([]interface{}, 0, h.opts.BatchSize)
+
+	// flushTimer is only running while there is a partial batch waiting
+	var flushTimer *time.Timer
+	var flush <-chan time.Time
+	stopTimer := func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushTimer, flush = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	send := func() error {
+		stopTimer()
+		if len(batch) == 0 {
+			return nil
+		}
+		err := h.send(batch, stage)
+		batch = make([]interface{}, 0, h.opts.BatchSize)
+		return err
+	}
+
+	for {
+		select {
+		case <-stage.Abort:
+			return nil
+		case <-flush:
+			if err := send(); err != nil {
+				return h.handleSendErr(err)
+			}
+		case rec, ok := <-stage.In:
+			if !ok {
+				return h.handleSendErr(send())
+			}
+
+			batch = append(batch, rec)
+			if len(batch) >= h.opts.BatchSize {
+				if err := send(); err != nil {
+					return h.handleSendErr(err)
+				}
+			} else if flushTimer == nil && h.opts.FlushInterval > 0 {
+				flushTimer = time.NewTimer(h.opts.FlushInterval)
+				flush = flushTimer.C
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (h *HTTPBulkWriter) SkipAbortErr() bool {
+	return true
+}
+
+// handleSendErr hides errAborted, as being aborted isn't a failure
+func (h *HTTPBulkWriter) handleSendErr(err error) error {
+	if err == errAborted {
+		return nil
+	}
+	return err
+}
+
+// send POSTs a batch, retrying while the server is unavailable, and reports the records it failed
+func (h *HTTPBulkWriter) send(batch []interface{}, stage *ingest.Stage) error {
+	body, contentType, err := h.opts.Encode(batch)
+	if err != nil {
+		return fmt.Errorf("HTTP Bulk Writer failed to encode a batch: %v", err)
+	}
+
+	backoff := h.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		status, respBody, retryAfter, err := h.post(body, contentType, stage)
+		if err == errAborted {
+			return err
+		}
+
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if !retryable {
+			if status >= 300 {
+				return fmt.Errorf("HTTP Bulk Writer got %d from %s: %s", status, h.url, respBody)
+			}
+			return h.reportItemErrors(batch, respBody, stage)
+		}
+
+		if err == nil {
+			err = fmt.Errorf("got %d: %s", status, respBody)
+		}
+		if attempt >= h.opts.MaxRetries {
+			return fmt.Errorf("HTTP Bulk Writer failed to send a batch to %s after %d attempts: %v", h.url, attempt+1, err)
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		h.logger.WithError(err).WithField("attempt", attempt+1).Warn("Retrying batch")
+
+		select {
+		case <-stage.Abort:
+			return errAborted
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a request, returning the status and body of the response along with how long the
+// server asked to wait before retrying, if it did. The request is cancelled if the stage is
+// aborted, returning errAborted
+func (h *HTTPBulkWriter) post(body []byte, contentType string, stage *ingest.Stage) (int, []byte, time.Duration, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	aborted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-stage.Abort:
+			cancel()
+			aborted <- true
+		case <-done:
+			aborted <- false
+		}
+	}()
+
+	status, respBody, retryAfter, err := h.request(ctx, body, contentType)
+	close(done)
+	if <-aborted {
+		return 0, nil, 0, errAborted
+	}
+	return status, respBody, retryAfter, err
+}
+
+// request sends a request with ctx
+func (h *HTTPBulkWriter) request(ctx context.Context, body []byte, contentType string) (int, []byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	for key, values := range h.opts.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := h.opts.Client.Do(req)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return resp.StatusCode, respBody, retryAfter, nil
+}
+
+// reportItemErrors sends the records the server failed to Errors, or logs them
+func (h *HTTPBulkWriter) reportItemErrors(batch []interface{}, body []byte, stage *ingest.Stage) error {
+	if h.opts.ItemErrors == nil {
+		return nil
+	}
+
+	for _, itemErr := range h.opts.ItemErrors(batch, body) {
+		if h.opts.Errors == nil {
+			h.logger.WithError(itemErr).Warn("Record failed")
+			continue
+		}
+		select {
+		case <-stage.Abort:
+			return errAborted
+		case h.opts.Errors <- itemErr:
+		}
+	}
+	return nil
+}
+
+// EncodeNDJSON encodes a batch as newline delimited JSON, one record per line
+func EncodeNDJSON(batch []interface{}) ([]byte, string, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, rec := range batch {
+		if err := encoder.Encode(rec); err != nil {
+			return nil, "", err
+		}
+	}
+	return body.Bytes(), "application/x-ndjson", nil
+}
+
+// EncodeElasticsearchBulk encodes a batch as the body of an Elasticsearch _bulk request, with an
+// index action line before each record. The index is taken from the URL, ie. /people/_bulk
+func EncodeElasticsearchBulk(batch []interface{}) ([]byte, string, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, rec := range batch {
+		body.WriteString(`{"index":{}}` + "\n")
+		if err := encoder.Encode(rec); err != nil {
+			return nil, "", err
+		}
+	}
+	return body.Bytes(), "application/x-ndjson", nil
+}
+
+// EncodeJSONArray encodes a batch as a JSON array of the records
+func EncodeJSONArray(batch []interface{}) ([]byte, string, error) {
+	body, err := json.Marshal(batch)
+	return body, "application/json", err
+}
+
+// ElasticsearchItemErrors finds the failed records in the response to an Elasticsearch style bulk
+// request, which has an item for each record in the batch. Other responses have no failures
+func ElasticsearchItemErrors(batch []interface{}, body []byte) []ItemError {
+	var resp struct {
+		Errors bool                                   `json:"errors"`
+		Items  []map[string]elasticsearchItemResponse `json:"items"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || !resp.Errors || len(resp.Items) != len(batch) {
+		return nil
+	}
+
+	failed := []ItemError{}
+	for i, item := range resp.Items {
+		// Each item is keyed by the action it performed, ie. "index"
+		for _, result := range item {
+			if result.Status >= 300 || len(result.Error) != 0 {
+				failed = append(failed, ItemError{Record: batch[i], Status: result.Status, Err: errors.New(string(result.Error))})
+			}
+		}
+	}
+	return failed
+}
+
+// elasticsearchItemResponse is the result of a single item in an Elasticsearch bulk response
+type elasticsearchItemResponse struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
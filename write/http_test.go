@@ -0,0 +1,206 @@
+package write
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+)
+
+// bulkServer records the requests sent to it, responding with the statuses given in turn
+type bulkServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	bodies       []string
+	contentTypes []string
+	statuses     []int
+	response     string
+}
+
+func newBulkServer(statuses ...int) *bulkServer {
+	server := &bulkServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		server.mu.Lock()
+		server.bodies = append(server.bodies, string(body))
+		server.contentTypes = append(server.contentTypes, r.Header.Get("Content-Type"))
+		status := http.StatusOK
+		if len(server.statuses) != 0 {
+			status, server.statuses = server.statuses[0], server.statuses[1:]
+		}
+		response := server.response
+		server.mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	return server
+}
+
+func (b *bulkServer) requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.bodies...)
+}
+
+func TestHTTPBulk(t *testing.T) {
+	type Doc struct {
+		ID int `json:"id"`
+	}
+
+	Convey("HTTPBulk", t, func() {
+		docs := []interface{}{Doc{1}, Doc{2}, Doc{3}}
+
+		Convey("sends batches as NDJSON, flushing the last one on completion", func() {
+			server := newBulkServer()
+			Reset(server.Close)
+
+			So(from(docs...).Then(HTTPBulk(server.URL, BulkOpts{BatchSize: 2})).Build().Run(), ShouldBeNil)
+			So(server.requests(), ShouldResemble, []string{"{\"id\":1}\n{\"id\":2}\n", "{\"id\":3}\n"})
+			So(server.contentTypes[0], ShouldEqual, "application/x-ndjson")
+		})
+
+		Convey("sends batches as JSON arrays", func() {
+			server := newBulkServer()
+			Reset(server.Close)
+
+			So(from(docs...).Then(HTTPBulk(server.URL, BulkOpts{Encode: EncodeJSONArray})).Build().Run(), ShouldBeNil)
+			So(server.requests(), ShouldResemble, []string{`[{"id":1},{"id":2},{"id":3}]`})
+			So(server.contentTypes[0], ShouldEqual, "application/json")
+		})
+
+		Convey("sends partial batches after FlushInterval", func() {
+			server := newBulkServer()
+			Reset(server.Close)
+
+			in := make(chan interface{})
+			errChan := ingest.StreamFrom(in).Then(HTTPBulk(server.URL, BulkOpts{FlushInterval: 10 * time.Millisecond})).Build().RunAsync()
+			in <- Doc{1}
+			time.Sleep(100 * time.Millisecond)
+			So(server.requests(), ShouldResemble, []string{"{\"id\":1}\n"})
+
+			in <- Doc{2}
+			close(in)
+			So(<-errChan, ShouldBeNil)
+			So(server.requests(), ShouldHaveLength, 2)
+		})
+
+		Convey("retries 429 and 5xx responses with backoff", func() {
+			server := newBulkServer(http.StatusTooManyRequests, http.StatusServiceUnavailable)
+			Reset(server.Close)
+
+			So(from(docs...).Then(HTTPBulk(server.URL, BulkOpts{Backoff: time.Millisecond})).Build().Run(), ShouldBeNil)
+			So(server.requests(), ShouldHaveLength, 3)
+		})
+
+		Convey("gives up after MaxRetries", func() {
+			server := newBulkServer(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+			Reset(server.Close)
+
+			err := from(docs...).Then(HTTPBulk(server.URL, BulkOpts{MaxRetries: 1, Backoff: time.Millisecond})).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "after 2 attempts")
+			So(server.requests(), ShouldHaveLength, 2)
+		})
+
+		Convey("fails without retrying other errors", func() {
+			server := newBulkServer(http.StatusBadRequest)
+			Reset(server.Close)
+
+			err := from(docs...).Then(HTTPBulk(server.URL)).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "400")
+			So(server.requests(), ShouldHaveLength, 1)
+		})
+
+		Convey("sends the records the server failed to Errors", func() {
+			server := newBulkServer()
+			server.response = `{"errors":true,"items":[
+				{"index":{"status":201}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}},
+				{"index":{"status":201}}
+			]}`
+			Reset(server.Close)
+
+			failures := make(chan ItemError, 3)
+			opts := BulkOpts{Encode: EncodeElasticsearchBulk, ItemErrors: ElasticsearchItemErrors, Errors: failures}
+			So(from(docs...).Then(HTTPBulk(server.URL, opts)).Build().Run(), ShouldBeNil)
+			So(server.requests(), ShouldResemble, []string{
+				"{\"index\":{}}\n{\"id\":1}\n{\"index\":{}}\n{\"id\":2}\n{\"index\":{}}\n{\"id\":3}\n",
+			})
+			close(failures)
+
+			failed := []ItemError{}
+			for failure := range failures {
+				failed = append(failed, failure)
+			}
+			So(failed, ShouldHaveLength, 1)
+			So(failed[0].Record, ShouldResemble, Doc{2})
+			So(failed[0].Status, ShouldEqual, 400)
+			So(failed[0].Err.Error(), ShouldContainSubstring, "mapper_parsing_exception")
+		})
+
+		Convey("drops the partial batch on abort", func() {
+			server := newBulkServer()
+			Reset(server.Close)
+
+			stage := ingest.NewStage()
+			abort := make(chan chan error)
+			stage.Abort = abort
+			done := make(chan error)
+			go func() { done <- HTTPBulk(server.URL, BulkOpts{FlushInterval: -1}).Run(stage) }()
+
+			stage.In <- Doc{1}
+			abort <- make(chan error)
+			So(<-done, ShouldBeNil)
+			So(server.requests(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("HTTPBulk cancels a request in flight on abort", t, func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		Reset(func() {
+			close(release)
+			server.Close()
+		})
+
+		abort := make(chan chan error)
+		stage := &ingest.Stage{In: make(chan interface{}), Abort: abort}
+		done := make(chan error)
+		go func() { done <- HTTPBulk(server.URL, BulkOpts{BatchSize: 1}).Run(stage) }()
+
+		stage.In <- Doc{1}
+		time.Sleep(20 * time.Millisecond)
+		abort <- make(chan error)
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(time.Second):
+			So("the request to be cancelled", ShouldBeNil)
+		}
+	})
+
+	Convey("EncodeNDJSON", t, func() {
+		body, _, err := EncodeNDJSON([]interface{}{map[string]int{"a": 1}, "b"})
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		So(lines, ShouldHaveLength, 2)
+		var first map[string]int
+		So(json.Unmarshal([]byte(lines[0]), &first), ShouldBeNil)
+	})
+}
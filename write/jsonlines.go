@@ -0,0 +1,34 @@
+package write
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonLinesEncoder writes each record as a line of JSON
+type jsonLinesEncoder struct {
+	encoder *json.Encoder
+}
+
+// JSONLines returns a *Writer that writes the records it receives to a file at path, one JSON
+// object per line
+//
+// Records are encoded with encoding/json, so structs are written using their json struct tags, as
+// with parse.JSON
+func JSONLines(path string, opts ...WriteOpts) *Writer {
+	return newWriter("JSON Lines Writer", path, newJSONLinesEncoder, opts)
+}
+
+func newJSONLinesEncoder(w io.Writer, out *Writer) encoder {
+	return &jsonLinesEncoder{encoder: json.NewEncoder(w)}
+}
+
+// encode implements encoder for jsonLinesEncoder
+func (j *jsonLinesEncoder) encode(rec interface{}) error {
+	return j.encoder.Encode(rec)
+}
+
+// flush implements encoder for jsonLinesEncoder. The encoder doesn't buffer anything itself
+func (j *jsonLinesEncoder) flush() error {
+	return nil
+}
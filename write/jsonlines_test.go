@@ -0,0 +1,29 @@
+package write
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONLines(t *testing.T) {
+	type Person struct {
+		ID   int    `json:"id"`
+		Name string `json:"name,omitempty"`
+	}
+
+	Convey("JSONLines", t, func() {
+		dir, err := ioutil.TempDir("", "ingest-jsonlines-")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "people.jsonl.gz")
+
+		Convey("writes a record per line using their json tags", func() {
+			_, err := run(JSONLines(path), Person{ID: 1, Name: "Ada"}, &Person{ID: 2}, map[string]int{"id": 3})
+			So(err, ShouldBeNil)
+			So(readGzip(path), ShouldEqual, "{\"id\":1,\"name\":\"Ada\"}\n{\"id\":2}\n{\"id\":3}\n")
+		})
+	})
+}
@@ -0,0 +1,368 @@
+package write
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+// Dialects of SQL supported by SQLWriter
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// maxParams are the most parameters a statement may have in each dialect. SQLite before 3.32
+// allows 999
+var maxParams = map[string]int{
+	Postgres: 65535,
+	SQLite:   999,
+}
+
+type (
+	// A SQLWriter is a Runner that inserts the records it receives into a table
+	//
+	// The records are inserted in batches, within a single transaction which is committed once the
+	// pipeline has completed. If the pipeline fails or is aborted, nothing is inserted
+	SQLWriter struct {
+		db     *sql.DB
+		opts   *SQLOpts
+		logger ingest.Logger
+
+		mu       sync.Mutex
+		tx       *sql.Tx
+		columns  []string
+		inserted int
+		failed   bool
+	}
+
+	// SQLOpts are options used to configure a SQLWriter
+	SQLOpts struct {
+		// Table is the table the records are inserted into. It is required
+		Table string
+
+		// Batch is the number of records inserted by each statement. Defaults to 100. Batches with
+		// more values than the database accepts in a statement are split over several statements
+		Batch int
+
+		// Columns are the columns inserted, in order. Defaults to the fields of the first record
+		Columns []string
+
+		// OnConflict turns the inserts into upserts. Defaults to a plain insert
+		OnConflict *Conflict
+
+		// Dialect is the dialect of SQL spoken by the database, either Postgres or SQLite. Defaults
+		// to SQLite for the sqlite3 driver, and Postgres otherwise
+		Dialect string
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// Conflict describes what is done when an inserted record conflicts with an existing row
+	Conflict struct {
+		// Columns are the unique columns that conflict, ie. the primary key. They are required unless
+		// DoNothing is set
+		Columns []string
+
+		// Update are the columns updated with the inserted values. Defaults to every column that
+		// isn't in Columns
+		Update []string
+
+		// DoNothing leaves the existing row as it is
+		DoNothing bool
+	}
+)
+
+func defaultSQLOpts() SQLOpts {
+	return SQLOpts{
+		Batch:  100,
+		Logger: ingest.DefaultLogger,
+	}
+}
+
+// SQL returns a *SQLWriter that inserts the records it receives into a table of db
+//
+// Structs are inserted using their db struct tags, and maps by their keys
+func SQL(db *sql.DB, opts ...SQLOpts) *SQLWriter {
+	opt := defaultSQLOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	if opt.Dialect == "" {
+		opt.Dialect = Postgres
+		if strings.Contains(strings.ToLower(fmt.Sprintf("%T", db.Driver())), "sqlite") {
+			opt.Dialect = SQLite
+		}
+	}
+
+	return &SQLWriter{
+		db:     db,
+		opts:   &opt,
+		logger: opt.Logger.WithField("processor", "sql writer").WithField("table", opt.Table),
+	}
+}
+
+// Name implements ingest.Runner for SQLWriter
+func (s *SQLWriter) Name() string {
+	return "SQL Writer"
+}
+
+// Run implements ingest.Runner for SQLWriter
+//
+// If an insert fails the rest of the input is drained, so that the job fails rather than the
+// stages before it blocking
+func (s *SQLWriter) Run(stage *ingest.Stage) error {
+	if s.opts.Table == "" {
+		return s.fail(stage, errors.New("SQL Writer requires a Table"))
+	}
+	if conflict := s.opts.OnConflict; conflict != nil && len(conflict.Columns) == 0 && !conflict.DoNothing {
+		return s.fail(stage, errors.New("SQL Writer requires the Columns that conflict to update on conflict"))
+	}
+
+	s.mu.Lock()
+	s.tx, s.columns, s.inserted, s.failed = nil, s.opts.Columns, 0, false
+	s.mu.Unlock()
+
+	batch := make([]map[string]interface{}, 0, s.opts.Batch)
+	for {
+		select {
+		case <-stage.Abort:
+			s.rollback()
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				if err := s.insert(batch); err != nil {
+					s.rollback()
+					return err
+				}
+				return nil
+			}
+
+			values, err := valuesOf(rec, "db")
+			if err != nil {
+				return s.fail(stage, err)
+			}
+			if s.columns == nil {
+				s.columns = columnsOf(rec, values, "db")
+			}
+
+			batch = append(batch, values)
+			if len(batch) >= s.opts.Batch {
+				if err := s.insert(batch); err != nil {
+					return s.fail(stage, err)
+				}
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (s *SQLWriter) SkipAbortErr() bool {
+	return true
+}
+
+// OnPipelineFailed implements ingest.OnFail for SQLWriter, so that the records inserted are rolled
+// back rather than committed
+func (s *SQLWriter) OnPipelineFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+}
+
+// OnPipelineDone implements ingest.OnDone for SQLWriter, committing the records inserted unless
+// the pipeline failed
+func (s *SQLWriter) OnPipelineDone() error {
+	s.mu.Lock()
+	tx, failed := s.tx, s.failed
+	s.tx = nil
+	s.mu.Unlock()
+
+	if tx == nil {
+		return nil
+	}
+	if failed {
+		s.logger.WithField("records", s.inserted).Warn("Rolling back records after the pipeline failed or was aborted")
+		return tx.Rollback()
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SQL Writer failed to commit to %s: %v", s.opts.Table, err)
+	}
+	s.logger.WithField("records", s.inserted).Info("Inserted records")
+	return nil
+}
+
+// fail rolls back the records inserted and drains the input, returning err once it is closed
+func (s *SQLWriter) fail(stage *ingest.Stage, err error) error {
+	s.rollback()
+	for {
+		select {
+		case <-stage.Abort:
+			return err
+		case _, ok := <-stage.In:
+			if !ok {
+				return err
+			}
+		}
+	}
+}
+
+// insert inserts a batch of records, starting the transaction if it hasn't been yet. The batch is
+// split over several statements if it has more values than the dialect accepts in one
+func (s *SQLWriter) insert(batch []map[string]interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("SQL Writer failed to begin a transaction: %v", err)
+		}
+		s.tx = tx
+	}
+
+	rows := len(batch)
+	if limit, isLimited := maxParams[s.opts.Dialect]; isLimited && len(s.columns) > 0 {
+		rows = limit / len(s.columns)
+		if rows < 1 {
+			rows = 1
+		}
+	}
+
+	for len(batch) > 0 {
+		chunk := batch
+		if len(chunk) > rows {
+			chunk = chunk[:rows]
+		}
+		batch = batch[len(chunk):]
+
+		args := make([]interface{}, 0, len(chunk)*len(s.columns))
+		for _, values := range chunk {
+			for _, column := range s.columns {
+				args = append(args, values[column])
+			}
+		}
+		if _, err := s.tx.Exec(s.insertStatement(len(chunk)), args...); err != nil {
+			return fmt.Errorf("SQL Writer failed to insert into %s: %v", s.opts.Table, err)
+		}
+		s.inserted += len(chunk)
+	}
+	return nil
+}
+
+// rollback rolls back the transaction, if one was started
+func (s *SQLWriter) rollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+}
+
+// insertStatement builds the statement inserting rows records
+func (s *SQLWriter) insertStatement(rows int) string {
+	var statement strings.Builder
+	statement.WriteString("INSERT INTO ")
+	statement.WriteString(quoteIdentifier(s.opts.Table))
+	statement.WriteString(" (")
+	statement.WriteString(quoteIdentifiers(s.columns))
+	statement.WriteString(") VALUES ")
+
+	param := 0
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			statement.WriteString(", ")
+		}
+		statement.WriteString("(")
+		for col := range s.columns {
+			if col > 0 {
+				statement.WriteString(", ")
+			}
+			param++
+			statement.WriteString(s.placeholder(param))
+		}
+		statement.WriteString(")")
+	}
+
+	statement.WriteString(s.conflictClause())
+	return statement.String()
+}
+
+// placeholder returns the placeholder of the n'th parameter of a statement
+func (s *SQLWriter) placeholder(n int) string {
+	if s.opts.Dialect == Postgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// conflictClause returns the ON CONFLICT clause of the insert statement, if there is one. SQLite
+// and Postgres share the same syntax
+func (s *SQLWriter) conflictClause() string {
+	conflict := s.opts.OnConflict
+	if conflict == nil {
+		return ""
+	}
+
+	clause := " ON CONFLICT"
+	if len(conflict.Columns) != 0 {
+		clause += " (" + quoteIdentifiers(conflict.Columns) + ")"
+	}
+
+	update := conflict.Update
+	if update == nil {
+		for _, column := range s.columns {
+			if !contains(conflict.Columns, column) {
+				update = append(update, column)
+			}
+		}
+	}
+	if conflict.DoNothing || len(update) == 0 {
+		return clause + " DO NOTHING"
+	}
+
+	sets := make([]string, len(update))
+	for i, column := range update {
+		sets[i] = quoteIdentifier(column) + " = excluded." + quoteIdentifier(column)
+	}
+	return clause + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// quoteIdentifier quotes a table or column name, quoting each part of a name like schema.table
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.Replace(part, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteIdentifiers quotes a list of column names
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// contains checks whether a name is in a list of names
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
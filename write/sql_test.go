@@ -0,0 +1,213 @@
+package write
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// from builds a pipeline that emits the records
+func from(records ...interface{}) *ingest.Pipeline {
+	in := make(chan interface{}, len(records))
+	for _, rec := range records {
+		in <- rec
+	}
+	close(in)
+	return ingest.StreamFrom(in)
+}
+
+// failingRunner fails once its input is closed
+type failingRunner struct{}
+
+func (f failingRunner) Name() string {
+	return "Failing Runner"
+}
+
+func (f failingRunner) Run(stage *ingest.Stage) error {
+	for rec := range stage.In {
+		stage.Out <- rec
+	}
+	return errors.New("upstream failed")
+}
+
+func TestSQL(t *testing.T) {
+	type Base struct {
+		ID int `db:"id"`
+	}
+
+	type Person struct {
+		Base
+		Name string `db:"name"`
+		Age  int    `db:"age"`
+		Note string `db:"-"`
+	}
+
+	Convey("SQL", t, func() {
+		dir, err := ioutil.TempDir("", "ingest-sql-")
+		So(err, ShouldBeNil)
+		db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			db.Close()
+			os.RemoveAll(dir)
+		})
+		_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)`)
+		So(err, ShouldBeNil)
+
+		people := func() []Person {
+			rows, err := db.Query(`SELECT id, name, age FROM people ORDER BY id`)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			result := []Person{}
+			for rows.Next() {
+				var person Person
+				So(rows.Scan(&person.ID, &person.Name, &person.Age), ShouldBeNil)
+				result = append(result, person)
+			}
+			return result
+		}
+
+		records := []interface{}{
+			Person{Base: Base{1}, Name: "Ada", Age: 36, Note: "ignored"},
+			&Person{Base: Base{2}, Name: "Bob", Age: 40},
+			map[string]interface{}{"id": 3, "name": "Cy", "age": 22},
+		}
+
+		Convey("detects the dialect from the driver", func() {
+			So(SQL(db).opts.Dialect, ShouldEqual, SQLite)
+		})
+
+		Convey("inserts records in batches using their db tags", func() {
+			So(from(records...).Then(SQL(db, SQLOpts{Table: "people", Batch: 2})).Build().Run(), ShouldBeNil)
+			So(people(), ShouldResemble, []Person{
+				{Base: Base{1}, Name: "Ada", Age: 36},
+				{Base: Base{2}, Name: "Bob", Age: 40},
+				{Base: Base{3}, Name: "Cy", Age: 22},
+			})
+		})
+
+		Convey("upserts records OnConflict", func() {
+			_, err := db.Exec(`INSERT INTO people (id, name, age) VALUES (1, 'Ada', 35), (2, 'Robert', 39)`)
+			So(err, ShouldBeNil)
+
+			conflict := &Conflict{Columns: []string{"id"}}
+			So(from(records...).Then(SQL(db, SQLOpts{Table: "people", OnConflict: conflict})).Build().Run(), ShouldBeNil)
+			So(people(), ShouldResemble, []Person{
+				{Base: Base{1}, Name: "Ada", Age: 36},
+				{Base: Base{2}, Name: "Bob", Age: 40},
+				{Base: Base{3}, Name: "Cy", Age: 22},
+			})
+
+			Convey("updating only the columns given", func() {
+				conflict := &Conflict{Columns: []string{"id"}, Update: []string{"age"}}
+				writer := SQL(db, SQLOpts{Table: "people", OnConflict: conflict})
+				So(ingest.StartWith(Person{Base: Base{1}, Name: "Ada L.", Age: 37}).Then(writer).Build().Run(), ShouldBeNil)
+				So(people()[0], ShouldResemble, Person{Base: Base{1}, Name: "Ada", Age: 37})
+			})
+
+			Convey("or doing nothing", func() {
+				conflict := &Conflict{DoNothing: true}
+				writer := SQL(db, SQLOpts{Table: "people", OnConflict: conflict})
+				So(ingest.StartWith(Person{Base: Base{1}, Name: "Ada L.", Age: 37}).Then(writer).Build().Run(), ShouldBeNil)
+				So(people()[0], ShouldResemble, Person{Base: Base{1}, Name: "Ada", Age: 36})
+			})
+		})
+
+		Convey("rolls back when the pipeline fails", func() {
+			err := from(records...).Then(failingRunner{}).Then(SQL(db, SQLOpts{Table: "people", Batch: 1})).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "upstream failed")
+			So(people(), ShouldBeEmpty)
+		})
+
+		Convey("rolls back when an insert fails", func() {
+			err := from(records[0], records[0]).Then(SQL(db, SQLOpts{Table: "people", Batch: 1})).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "UNIQUE")
+			So(people(), ShouldBeEmpty)
+		})
+
+		Convey("splits batches with more values than the database accepts in a statement", func() {
+			_, err := db.Exec(`CREATE TABLE wide (c0, c1, c2, c3, c4, c5, c6, c7, c8, c9)`)
+			So(err, ShouldBeNil)
+
+			in := make(chan interface{})
+			go func() {
+				defer close(in)
+				for i := 0; i < 150; i++ {
+					row := map[string]interface{}{}
+					for c := 0; c < 10; c++ {
+						row[fmt.Sprintf("c%d", c)] = i
+					}
+					in <- row
+				}
+			}()
+			So(ingest.StreamFrom(in).Then(SQL(db, SQLOpts{Table: "wide"})).Build().Run(), ShouldBeNil)
+
+			var count int
+			So(db.QueryRow(`SELECT COUNT(*) FROM wide`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 150)
+		})
+
+		Convey("fails the job rather than blocking the stages before it when an insert fails", func() {
+			in := make(chan interface{})
+			go func() {
+				defer close(in)
+				for i := 0; i < 10; i++ {
+					in <- records[0]
+				}
+			}()
+			err := ingest.StreamFrom(in).Then(SQL(db, SQLOpts{Table: "people", Batch: 1})).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "UNIQUE")
+			So(people(), ShouldBeEmpty)
+		})
+
+		Convey("rolls back on abort", func() {
+			in := make(chan interface{})
+			job := ingest.StreamFrom(in).Then(SQL(db, SQLOpts{Table: "people", Batch: 1})).Build().Start()
+			in <- records[0]
+			<-job.Abort()
+			So(job.Wait(), ShouldBeNil)
+			So(people(), ShouldBeEmpty)
+		})
+
+		Convey("rolls back a stage that completed before it was aborted", func() {
+			writer := SQL(db, SQLOpts{Table: "people"})
+			stage := ingest.NewStage()
+			go func() {
+				stage.In <- records[0]
+				close(stage.In)
+			}()
+			So(writer.Run(stage), ShouldBeNil)
+			writer.OnPipelineFailed(ingest.ErrAborted)
+			So(writer.OnPipelineDone(), ShouldBeNil)
+			So(people(), ShouldBeEmpty)
+		})
+
+		Convey("requires a Table", func() {
+			So(from().Then(SQL(db)).Build().Run(), ShouldNotBeNil)
+		})
+
+		Convey("requires the conflicting Columns to update on conflict", func() {
+			err := from().Then(SQL(db, SQLOpts{Table: "people", OnConflict: &Conflict{Update: []string{"age"}}})).Build().Run()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Columns")
+		})
+	})
+
+	Convey("insertStatement", t, func() {
+		writer := SQL(nil, SQLOpts{Table: "public.people", Dialect: Postgres, OnConflict: &Conflict{Columns: []string{"id"}}})
+		writer.columns = []string{"id", "name"}
+		So(writer.insertStatement(2), ShouldEqual,
+			`INSERT INTO "public"."people" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name"`)
+	})
+}
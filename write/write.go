@@ -0,0 +1,351 @@
+package write
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urbint/ingest"
+	"github.com/urbint/ingest/utils"
+)
+
+type (
+	// A Writer is a Runner that encodes the records it receives to files. Each file is written to a
+	// temporary file beside it, and renamed into place once the pipeline has completed
+	Writer struct {
+		name       string
+		path       string
+		opts       *WriteOpts
+		logger     ingest.Logger
+		newEncoder func(w io.Writer, writer *Writer) encoder
+
+		mu      sync.Mutex
+		pending []*outputFile
+		paths   []string
+		failed  bool
+
+		// columns are the columns of the run, either WriteOpts.Columns or those of its first record
+		columns []string
+	}
+
+	// WriteOpts are options used to configure a Writer
+	WriteOpts struct {
+		// Gzip compresses the files written. Paths ending in .gz are always compressed
+		Gzip bool
+
+		// MaxRecords is the most records written to each file. Once a file is full the records after
+		// it are written to a new file, and every file is numbered (ie. people.0001.csv). Defaults to
+		// no limit
+		MaxRecords int
+
+		// MaxBytes is the size in bytes, before compression, after which a new file is started.
+		// Files are numbered as with MaxRecords. Defaults to no limit
+		MaxBytes int64
+
+		// Columns are the columns written by CSV, in order. Defaults to the fields of the first record,
+		// in the order they are declared (or sorted, for maps)
+		Columns []string
+
+		// DateFormat is the format CSV writes dates with. Defaults to the same format as parse.CSV
+		DateFormat string
+
+		// Logger is the logger to be used. It defaults to the DefaultLogger set on ingest
+		Logger ingest.Logger
+	}
+
+	// encoder encodes records to a file
+	encoder interface {
+		// encode writes a record
+		encode(rec interface{}) error
+
+		// flush writes anything buffered by the encoder
+		flush() error
+	}
+
+	// outputFile is a file being written, which is renamed to its path once the pipeline completes
+	outputFile struct {
+		path    string
+		file    *os.File
+		gzip    *gzip.Writer
+		buf     *bufio.Writer
+		counter *countingWriter
+		encoder encoder
+		records int
+	}
+
+	// countingWriter counts the bytes written through it
+	countingWriter struct {
+		io.Writer
+		count int64
+	}
+)
+
+func defaultWriteOpts() WriteOpts {
+	return WriteOpts{
+		DateFormat: "01/02/2006",
+		Logger:     ingest.DefaultLogger,
+	}
+}
+
+func newWriter(name string, path string, newEncoder func(w io.Writer, writer *Writer) encoder, opts []WriteOpts) *Writer {
+	opt := defaultWriteOpts()
+	if len(opts) != 0 {
+		utils.Extend(&opt, opts[0])
+	}
+
+	return &Writer{
+		name:       name,
+		path:       path,
+		opts:       &opt,
+		logger:     opt.Logger.WithField("processor", strings.ToLower(name)),
+		newEncoder: newEncoder,
+	}
+}
+
+// Name implements ingest.Runner for Writer
+func (w *Writer) Name() string {
+	return w.name
+}
+
+// Run implements ingest.Runner for Writer
+//
+// The files are kept as temporary files until the pipeline has completed, when OnPipelineDone
+// renames them into place. If the job fails or is aborted they are removed instead
+func (w *Writer) Run(stage *ingest.Stage) error {
+	w.mu.Lock()
+	w.pending, w.paths, w.failed, w.columns = nil, nil, false, w.opts.Columns
+	w.mu.Unlock()
+
+	// The first file is written even if there are no records, so that the output always exists
+	current, err := w.create(1)
+	if err != nil {
+		return err
+	}
+	count := 1
+
+	for {
+		select {
+		case <-stage.Abort:
+			if current != nil {
+				current.discard()
+			}
+			w.discardPending()
+			return nil
+		case rec, ok := <-stage.In:
+			if !ok {
+				if current == nil {
+					return nil
+				}
+				return w.finish(current)
+			}
+
+			if current == nil {
+				count++
+				if current, err = w.create(count); err != nil {
+					w.discardPending()
+					return err
+				}
+			}
+			if err := current.write(rec); err != nil {
+				current.discard()
+				w.discardPending()
+				return fmt.Errorf("%s failed to write %s: %v", w.name, current.path, err)
+			}
+
+			if w.isFull(current) {
+				if err := w.finish(current); err != nil {
+					return err
+				}
+				current = nil
+			}
+		}
+	}
+}
+
+// SkipAbortErr saves us having to send nil errors back on abort
+func (w *Writer) SkipAbortErr() bool {
+	return true
+}
+
+// OnPipelineFailed implements ingest.OnFail for Writer, so that the files written are removed
+// rather than renamed into place
+func (w *Writer) OnPipelineFailed(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failed = true
+}
+
+// OnPipelineDone implements ingest.OnDone for Writer, renaming the files written into place unless
+// the pipeline failed
+func (w *Writer) OnPipelineDone() error {
+	w.mu.Lock()
+	pending, failed := w.pending, w.failed
+	w.pending = nil
+	w.mu.Unlock()
+
+	if failed {
+		for _, out := range pending {
+			out.discard()
+		}
+		return nil
+	}
+
+	for i, out := range pending {
+		if err := os.Rename(out.file.Name(), out.path); err != nil {
+			for _, rest := range pending[i:] {
+				rest.discard()
+			}
+			return fmt.Errorf("%s failed to write %s: %v", w.name, out.path, err)
+		}
+		w.logger.WithField("file", out.path).WithField("records", out.records).Info("Wrote file")
+
+		w.mu.Lock()
+		w.paths = append(w.paths, out.path)
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// Paths returns the paths of the files renamed into place by the last run
+func (w *Writer) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.paths...)
+}
+
+// rotates checks whether the records are split between numbered files
+func (w *Writer) rotates() bool {
+	return w.opts.MaxRecords > 0 || w.opts.MaxBytes > 0
+}
+
+// isFull checks whether a new file should be started after the current one
+func (w *Writer) isFull(current *outputFile) bool {
+	return (w.opts.MaxRecords > 0 && current.records >= w.opts.MaxRecords) ||
+		(w.opts.MaxBytes > 0 && current.counter.count >= w.opts.MaxBytes)
+}
+
+// create starts writing the count'th file to a temporary file in the same directory
+func (w *Writer) create(count int) (*outputFile, error) {
+	path := w.path
+	if w.rotates() {
+		path = numberedPath(w.path, count)
+	}
+
+	dir, base := filepath.Split(path)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := createTemp(dir, base)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &outputFile{path: path, file: file}
+	var dest io.Writer = file
+	if w.opts.Gzip || strings.HasSuffix(strings.ToLower(path), ".gz") {
+		out.gzip = gzip.NewWriter(file)
+		dest = out.gzip
+	}
+	out.buf = bufio.NewWriter(dest)
+	out.counter = &countingWriter{Writer: out.buf}
+	out.encoder = w.newEncoder(out.counter, w)
+	return out, nil
+}
+
+// finish closes the file, keeping it until the pipeline has completed
+func (w *Writer) finish(current *outputFile) error {
+	if err := current.close(); err != nil {
+		current.discard()
+		w.discardPending()
+		return fmt.Errorf("%s failed to write %s: %v", w.name, current.path, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, current)
+	return nil
+}
+
+// discardPending removes the files waiting for the pipeline to complete
+func (w *Writer) discardPending() {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	for _, out := range pending {
+		out.discard()
+	}
+}
+
+// write encodes a record to the file
+func (o *outputFile) write(rec interface{}) error {
+	if err := o.encoder.encode(rec); err != nil {
+		return err
+	}
+	o.records++
+	return nil
+}
+
+// close flushes everything written to the file and closes it
+func (o *outputFile) close() error {
+	err := o.encoder.flush()
+	if err == nil {
+		err = o.buf.Flush()
+	}
+	if err == nil && o.gzip != nil {
+		err = o.gzip.Close()
+	}
+	if err == nil {
+		err = o.file.Sync()
+	}
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// discard closes and removes the temporary file
+func (o *outputFile) discard() {
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
+
+// Write implements io.Writer for countingWriter
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// numberedPath numbers a path before its extensions, ie. people.csv.gz becomes people.0001.csv.gz
+func numberedPath(path string, count int) string {
+	dir, base := filepath.Split(path)
+	name, exts := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, exts = base[:i], base[i:]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%04d%s", name, count, exts))
+}
+
+// createTemp creates a hidden temporary file for base in dir. Unlike ioutil.TempFile the file is
+// readable by others, as the umask allows, since it becomes the output once renamed
+func createTemp(dir string, base string) (*os.File, error) {
+	for attempt := 0; ; attempt++ {
+		suffix := strconv.FormatInt(time.Now().UnixNano()+int64(attempt), 36)
+		file, err := os.OpenFile(filepath.Join(dir, "."+base+"."+suffix+".tmp"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) && attempt < 10000 {
+			continue
+		}
+		return file, err
+	}
+}
@@ -0,0 +1,181 @@
+package write
+
+import (
+	"compress/gzip"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/urbint/ingest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// run writes the records with the writer in a Job, returning the paths it wrote
+func run(writer *Writer, records ...interface{}) ([]string, error) {
+	err := from(records...).Then(writer).Build().Run()
+	return writer.Paths(), err
+}
+
+// readGzip returns the decompressed contents of a gzipped file
+func readGzip(path string) string {
+	file, err := os.Open(path)
+	So(err, ShouldBeNil)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	So(err, ShouldBeNil)
+	content, err := ioutil.ReadAll(reader)
+	So(err, ShouldBeNil)
+	return string(content)
+}
+
+// filesIn returns the names of the files in a directory
+func filesIn(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	So(err, ShouldBeNil)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestWriter(t *testing.T) {
+	type Row struct {
+		Name string `json:"name"`
+	}
+
+	Convey("Writer", t, func() {
+		dir, err := ioutil.TempDir("", "ingest-write-")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "out", "people.jsonl")
+
+		Convey("creates the directory and writes the file once complete", func() {
+			paths, err := run(JSONLines(path), Row{"Ada"})
+			So(err, ShouldBeNil)
+			So(paths, ShouldResemble, []string{path})
+			So(filesIn(filepath.Dir(path)), ShouldResemble, []string{"people.jsonl"})
+		})
+
+		Convey("writes an empty file when there are no records", func() {
+			paths, err := run(JSONLines(path))
+			So(err, ShouldBeNil)
+			So(paths, ShouldResemble, []string{path})
+			content, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(content, ShouldBeEmpty)
+		})
+
+		Convey("gzips the file with Gzip, or when the path ends in .gz", func() {
+			_, err := run(JSONLines(path, WriteOpts{Gzip: true}), Row{"Ada"})
+			So(err, ShouldBeNil)
+			So(readGzip(path), ShouldEqual, "{\"name\":\"Ada\"}\n")
+
+			_, err = run(JSONLines(path+".gz"), Row{"Bob"})
+			So(err, ShouldBeNil)
+			So(readGzip(path+".gz"), ShouldEqual, "{\"name\":\"Bob\"}\n")
+		})
+
+		Convey("only renames the file into place once it is complete", func() {
+			stage := ingest.NewStage()
+			abort := make(chan chan error)
+			stage.Abort = abort
+			done := make(chan error)
+			go func() { done <- JSONLines(path).Run(stage) }()
+
+			stage.In <- Row{"Ada"}
+			_, err := os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			So(filesIn(filepath.Dir(path)), ShouldHaveLength, 1)
+
+			Convey("and removes it on abort", func() {
+				abort <- make(chan error)
+				So(<-done, ShouldBeNil)
+				So(filesIn(filepath.Dir(path)), ShouldBeEmpty)
+			})
+		})
+
+		Convey("waits for the pipeline to complete before renaming the file", func() {
+			writer := JSONLines(path)
+			stage := ingest.NewStage()
+			go func() {
+				stage.In <- Row{"Ada"}
+				close(stage.In)
+			}()
+			So(writer.Run(stage), ShouldBeNil)
+			_, err := os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			So(writer.OnPipelineDone(), ShouldBeNil)
+			So(writer.Paths(), ShouldResemble, []string{path})
+			So(filesIn(filepath.Dir(path)), ShouldResemble, []string{"people.jsonl"})
+		})
+
+		Convey("removes the files when an earlier stage fails", func() {
+			writer := JSONLines(path, WriteOpts{MaxRecords: 1})
+			count := 0
+			err := from(Row{"Ada"}, Row{"Bob"}, Row{"Cy"}).ForEach(func(rec interface{}) (interface{}, error) {
+				if count++; count == 3 {
+					return nil, errors.New("boom")
+				}
+				return rec, nil
+			}).Then(writer).Build().Run()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "boom")
+			So(writer.Paths(), ShouldBeEmpty)
+			So(filesIn(filepath.Dir(path)), ShouldBeEmpty)
+		})
+
+		Convey("writes files readable by others", func() {
+			_, err := run(JSONLines(path), Row{"Ada"})
+			So(err, ShouldBeNil)
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			umask := syscall.Umask(0)
+			syscall.Umask(umask)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0644&^umask))
+		})
+
+		Convey("rotates files by MaxRecords", func() {
+			paths, err := run(JSONLines(path, WriteOpts{MaxRecords: 2}), Row{"Ada"}, Row{"Bob"}, Row{"Cy"})
+			So(err, ShouldBeNil)
+			So(paths, ShouldResemble, []string{
+				filepath.Join(dir, "out", "people.0001.jsonl"),
+				filepath.Join(dir, "out", "people.0002.jsonl"),
+			})
+			content, err := ioutil.ReadFile(paths[1])
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "{\"name\":\"Cy\"}\n")
+		})
+
+		Convey("doesn't start a new file after the last record fills one", func() {
+			paths, err := run(JSONLines(path, WriteOpts{MaxRecords: 2}), Row{"Ada"}, Row{"Bob"})
+			So(err, ShouldBeNil)
+			So(paths, ShouldHaveLength, 1)
+		})
+
+		Convey("rotates files by MaxBytes", func() {
+			paths, err := run(JSONLines(path, WriteOpts{MaxBytes: 20}), Row{"Ada"}, Row{"Bob"}, Row{"Cy"})
+			So(err, ShouldBeNil)
+			So(paths, ShouldHaveLength, 2)
+			content, err := ioutil.ReadFile(paths[0])
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "{\"name\":\"Ada\"}\n{\"name\":\"Bob\"}\n")
+		})
+
+		Convey("fails on records it can't encode, leaving nothing behind", func() {
+			_, err := run(JSONLines(path), Row{"Ada"}, make(chan int))
+			So(err, ShouldNotBeNil)
+			So(filesIn(filepath.Dir(path)), ShouldBeEmpty)
+		})
+	})
+
+	Convey("numberedPath", t, func() {
+		So(numberedPath("data/people.csv.gz", 1), ShouldEqual, "data/people.0001.csv.gz")
+		So(numberedPath("people", 12), ShouldEqual, "people.0012")
+		So(numberedPath(".people", 2), ShouldEqual, ".people.0002")
+	})
+}